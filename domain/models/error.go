@@ -3,5 +3,10 @@ package models
 import "github.com/pkg/errors"
 
 var (
-	ErrNothingToUpdate = errors.New("nothing to update")
+	ErrNothingToUpdate  = errors.New("nothing to update")
+	ErrFieldNotNullable = errors.New("field can not be cleared")
+	ErrUnknownUserField = errors.New("unknown user field")
+	ErrEmailTaken       = errors.New("email already taken")
+	ErrTokenNotFound    = errors.New("token not found or expired")
+	ErrPasswordChanged  = errors.New("password was changed concurrently")
 )
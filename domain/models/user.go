@@ -1,18 +1,53 @@
 package models
 
-import "github.com/samber/mo"
+import (
+	"github.com/samber/mo"
+	"time"
+)
 
 type User struct {
-	ID           int32
-	Name         string
-	PasswordHash string
-	Username     string
-	Email        string
-	Bio          string
-	ProfileImage string
-	CoverImage   string
-	FollowingIDs []int32
-	FollowerIDs  []int32
+	ID                int32
+	Name              string
+	PasswordHash      string
+	Username          string
+	Email             string
+	Bio               string
+	ProfileImage      string
+	CoverImage        string
+	FollowingIDs      []int32
+	FollowerIDs       []int32
+	PasswordChangedAt time.Time
+}
+
+type UserField string
+
+const (
+	UserFieldName         UserField = "name"
+	UserFieldUsername     UserField = "username"
+	UserFieldBio          UserField = "bio"
+	UserFieldProfileImage UserField = "profile_image"
+	UserFieldCoverImage   UserField = "cover_image"
+)
+
+var updatableUserFields = map[UserField]bool{
+	UserFieldName:         false,
+	UserFieldUsername:     false,
+	UserFieldBio:          true,
+	UserFieldProfileImage: true,
+	UserFieldCoverImage:   true,
+}
+
+// ParseUserField maps an update mask path to an updatable field.
+func ParseUserField(path string) (UserField, bool) {
+	field := UserField(path)
+	_, ok := updatableUserFields[field]
+
+	return field, ok
+}
+
+// Nullable reports whether the field may be cleared to NULL.
+func (f UserField) Nullable() bool {
+	return updatableUserFields[f]
 }
 
 type UserOption struct {
@@ -22,4 +57,53 @@ type UserOption struct {
 	Bio          mo.Option[string]
 	ProfileImage mo.Option[string]
 	CoverImage   mo.Option[string]
+	// Mask lists the fields to write. An absent value for a masked
+	// nullable field clears it. When empty, only present values are written.
+	Mask []UserField
+}
+
+// Fields returns the fields to update, falling back to the present values
+// when no mask is set.
+func (u UserOption) Fields() []UserField {
+	if len(u.Mask) > 0 {
+		return u.Mask
+	}
+
+	fields := make([]UserField, 0, len(updatableUserFields))
+	for _, field := range []UserField{
+		UserFieldName,
+		UserFieldUsername,
+		UserFieldBio,
+		UserFieldProfileImage,
+		UserFieldCoverImage,
+	} {
+		if u.Value(field).IsPresent() {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+func (u UserOption) Value(field UserField) mo.Option[string] {
+	switch field {
+	case UserFieldName:
+		return u.Name
+	case UserFieldUsername:
+		return u.Username
+	case UserFieldBio:
+		return u.Bio
+	case UserFieldProfileImage:
+		return u.ProfileImage
+	case UserFieldCoverImage:
+		return u.CoverImage
+	default:
+		return mo.None[string]()
+	}
+}
+
+type EmailChange struct {
+	UserID   int32
+	OldEmail string
+	NewEmail string
 }
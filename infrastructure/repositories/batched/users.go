@@ -0,0 +1,275 @@
+package batched
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWait     = 2 * time.Millisecond
+	defaultMaxBatch = 100
+	defaultTimeout  = 10 * time.Second
+
+	resultFetched   = "fetched"
+	resultCoalesced = "coalesced"
+	resultPinned    = "pinned"
+)
+
+var (
+	batchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "users_loader_batch_size",
+		Help:    "Number of distinct user ids fetched by one batched query.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+	})
+	lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "users_loader_lookups_total",
+		Help: "User lookups by method and whether they joined another request.",
+	}, []string{"method", "result"})
+)
+
+type Config struct {
+	// Wait is how long ids are collected before a batch is sent.
+	Wait     time.Duration
+	MaxBatch int
+	// Timeout bounds the lookups of callers without a deadline.
+	Timeout time.Duration
+}
+
+// UsersRepository merges UsersByIDs calls made within a short window into a
+// single query and lets identical concurrent lookups share one result.
+//
+// Only a batch that is still collecting ids is joined. One already sent may
+// have read a user before the caller's last write to it, and the cache above
+// would keep that stale row.
+type UsersRepository struct {
+	usecases.UsersRepository
+	config Config
+
+	mu      sync.Mutex
+	pending *batch
+
+	emails singleflight.Group
+}
+
+// batch is fetched with the values of its first caller's context, such as
+// the trace and request ID, but not its cancellation: the callers each wait
+// on their own context instead. It lives until the latest deadline of its
+// callers, and reads from the primary when any of them asked to.
+type batch struct {
+	ctx      context.Context
+	ids      []int32
+	queued   map[int32]struct{}
+	deadline time.Time
+	primary  bool
+	done     chan struct{}
+	users    map[int32]models.User
+	err      error
+}
+
+func (r *UsersRepository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User, error) {
+	// A batch may be served by a replica, which could miss the caller's own
+	// writes.
+	if database.Pinned(ctx) {
+		lookups.WithLabelValues("UsersByIDs", resultPinned).Inc()
+		return r.UsersRepository.UsersByIDs(ctx, ids)
+	}
+
+	ids = lo.Uniq(ids)
+	batches := r.enqueue(ctx, ids)
+
+	users := make(map[int32]models.User, len(ids))
+
+	for _, b := range batches {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if b.err != nil {
+			return nil, b.err
+		}
+
+		for _, id := range ids {
+			user, ok := b.users[id]
+			if ok {
+				users[id] = user
+			}
+		}
+	}
+
+	return lo.FilterMap(ids, func(id int32, _ int) (models.User, bool) {
+		user, ok := users[id]
+		return user, ok
+	}), nil
+}
+
+// enqueue attaches every id to the collecting batch, which already holds it
+// or fetches it with the others, and returns the batches to wait for.
+func (r *UsersRepository) enqueue(ctx context.Context, ids []int32) []*batch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batches := make([]*batch, 0, 1)
+
+	for _, id := range ids {
+		if r.pending == nil {
+			r.pending = &batch{
+				ctx:    context.WithoutCancel(ctx),
+				queued: make(map[int32]struct{}),
+				done:   make(chan struct{}),
+			}
+			pending := r.pending
+			time.AfterFunc(r.wait(), func() { r.dispatch(pending) })
+		}
+
+		b := r.pending
+		b.deadline = later(b.deadline, r.deadline(ctx))
+		b.primary = b.primary || database.ReadsPrimary(ctx)
+		batches = appendBatch(batches, b)
+
+		if _, ok := b.queued[id]; ok {
+			lookups.WithLabelValues("UsersByIDs", resultCoalesced).Inc()
+			continue
+		}
+
+		lookups.WithLabelValues("UsersByIDs", resultFetched).Inc()
+
+		b.ids = append(b.ids, id)
+		b.queued[id] = struct{}{}
+
+		if len(b.ids) >= r.maxBatch() {
+			r.pending = nil
+			go r.fetch(b)
+		}
+	}
+
+	return batches
+}
+
+func (r *UsersRepository) dispatch(b *batch) {
+	r.mu.Lock()
+	if r.pending != b {
+		r.mu.Unlock()
+		return
+	}
+
+	r.pending = nil
+	r.mu.Unlock()
+
+	r.fetch(b)
+}
+
+func (r *UsersRepository) fetch(b *batch) {
+	batchSize.Observe(float64(len(b.ids)))
+
+	// The batch is no longer pending, so its deadline does not move.
+	ctx, cancel := context.WithDeadline(b.ctx, b.deadline)
+	defer cancel()
+
+	if b.primary {
+		ctx = database.WithPrimary(ctx)
+	}
+
+	users, err := r.UsersRepository.UsersByIDs(ctx, b.ids)
+
+	b.err = err
+	b.users = lo.KeyBy(users, func(user models.User) int32 { return user.ID })
+
+	close(b.done)
+}
+
+func (r *UsersRepository) UserByEmail(ctx context.Context, email string) (models.User, error) {
+	if database.Pinned(ctx) {
+		lookups.WithLabelValues("UserByEmail", resultPinned).Inc()
+		return r.UsersRepository.UserByEmail(ctx, email)
+	}
+
+	// The first caller's deadline and values carry over to the shared
+	// lookup, but not its cancellation, which would fail the others.
+	deadline := r.deadline(ctx)
+	results := r.emails.DoChan(email, func() (any, error) {
+		lookupCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		defer cancel()
+
+		return r.UsersRepository.UserByEmail(lookupCtx, email)
+	})
+
+	select {
+	case result := <-results:
+		lookups.WithLabelValues("UserByEmail", lo.Ternary(result.Shared, resultCoalesced, resultFetched)).Inc()
+
+		if result.Err != nil {
+			return models.User{}, result.Err
+		}
+
+		return result.Val.(models.User), nil
+	case <-ctx.Done():
+		return models.User{}, ctx.Err()
+	}
+}
+
+// deadline is the deadline of ctx, or the configured timeout from now.
+func (r *UsersRepository) deadline(ctx context.Context) time.Time {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Now().Add(r.timeout())
+	}
+
+	return deadline
+}
+
+func (r *UsersRepository) wait() time.Duration {
+	if r.config.Wait <= 0 {
+		return defaultWait
+	}
+
+	return r.config.Wait
+}
+
+func (r *UsersRepository) maxBatch() int {
+	if r.config.MaxBatch <= 0 {
+		return defaultMaxBatch
+	}
+
+	return r.config.MaxBatch
+}
+
+func (r *UsersRepository) timeout() time.Duration {
+	if r.config.Timeout <= 0 {
+		return defaultTimeout
+	}
+
+	return r.config.Timeout
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+func appendBatch(batches []*batch, b *batch) []*batch {
+	if lo.Contains(batches, b) {
+		return batches
+	}
+
+	return append(batches, b)
+}
+
+func NewUsersRepository(next usecases.UsersRepository, config Config) *UsersRepository {
+	return &UsersRepository{
+		UsersRepository: next,
+		config:          config,
+	}
+}
@@ -0,0 +1,230 @@
+package batched_test
+
+import (
+	"context"
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/batched"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/memory"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedRepository records the queries reaching the repository and holds
+// them until released.
+type gatedRepository struct {
+	*memory.UsersRepository
+
+	mu        sync.Mutex
+	queries   [][]int32
+	deadlines []time.Time
+	primary   []bool
+	requests  []any
+	gate      chan struct{}
+}
+
+// requestKey stands for the values of a request, such as its trace.
+type requestKey struct{}
+
+func (r *gatedRepository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User, error) {
+	deadline, _ := ctx.Deadline()
+
+	r.mu.Lock()
+	r.queries = append(r.queries, ids)
+	r.deadlines = append(r.deadlines, deadline)
+	r.primary = append(r.primary, database.ReadsPrimary(ctx))
+	r.requests = append(r.requests, ctx.Value(requestKey{}))
+	gate := r.gate
+	r.mu.Unlock()
+
+	if gate != nil {
+		<-gate
+	}
+
+	return r.UsersRepository.UsersByIDs(ctx, ids)
+}
+
+func (r *gatedRepository) UserByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.Lock()
+	r.requests = append(r.requests, ctx.Value(requestKey{}))
+	r.mu.Unlock()
+
+	return r.UsersRepository.UserByEmail(ctx, email)
+}
+
+func (r *gatedRepository) recorded() ([][]int32, []time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.queries, r.deadlines
+}
+
+func newRepository(t *testing.T, config batched.Config) (*batched.UsersRepository, *gatedRepository, []models.User) {
+	t.Helper()
+
+	next := &gatedRepository{UsersRepository: memory.NewUsersRepository()}
+
+	var users []models.User
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		user, err := next.Create(context.Background(), username, "hash", username, username+"@example.com")
+		require.NoError(t, err)
+
+		users = append(users, user)
+	}
+
+	return batched.NewUsersRepository(next, config), next, users
+}
+
+func TestConcurrentLookupsShareAQuery(t *testing.T) {
+	repo, next, users := newRepository(t, batched.Config{Wait: 50 * time.Millisecond})
+
+	var wg sync.WaitGroup
+
+	for _, ids := range [][]int32{{users[0].ID, users[1].ID}, {users[1].ID, users[2].ID}, {users[2].ID}} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			found, err := repo.UsersByIDs(context.Background(), ids)
+			assert.NoError(t, err)
+			assert.Len(t, found, len(ids))
+		}()
+	}
+
+	wg.Wait()
+
+	queries, _ := next.recorded()
+	require.Len(t, queries, 1)
+	assert.ElementsMatch(t, []int32{users[0].ID, users[1].ID, users[2].ID}, queries[0])
+}
+
+func TestSentBatchIsNotJoined(t *testing.T) {
+	ctx := context.Background()
+	repo, next, users := newRepository(t, batched.Config{Wait: time.Millisecond})
+	alice := users[0]
+
+	next.gate = make(chan struct{})
+
+	stale := make(chan []models.User)
+
+	go func() {
+		found, err := repo.UsersByIDs(ctx, []int32{alice.ID})
+		assert.NoError(t, err)
+		stale <- found
+	}()
+
+	require.Eventually(t, func() bool {
+		queries, _ := next.recorded()
+		return len(queries) == 1
+	}, time.Second, time.Millisecond)
+
+	_, err := next.UpdateByID(ctx, models.UserOption{ID: alice.ID, Name: mo.Some("Alicia")})
+	require.NoError(t, err)
+
+	fresh := make(chan []models.User)
+
+	go func() {
+		found, err := repo.UsersByIDs(ctx, []int32{alice.ID})
+		assert.NoError(t, err)
+		fresh <- found
+	}()
+
+	require.Eventually(t, func() bool {
+		queries, _ := next.recorded()
+		return len(queries) == 2
+	}, time.Second, time.Millisecond, "the lookup after the write sends its own batch")
+
+	close(next.gate)
+
+	assert.Equal(t, "Alicia", (<-fresh)[0].Name)
+	<-stale
+}
+
+func TestBatchOutlivesItsCallers(t *testing.T) {
+	repo, next, users := newRepository(t, batched.Config{Wait: 20 * time.Millisecond, Timeout: time.Hour})
+
+	short, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	long, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := repo.UsersByIDs(short, []int32{users[0].ID})
+		errs <- err
+	}()
+
+	found, err := repo.UsersByIDs(long, []int32{users[0].ID, users[1].ID})
+	require.NoError(t, err)
+	assert.Len(t, found, 2, "the short caller giving up does not fail the batch")
+	assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+
+	queries, deadlines := next.recorded()
+	require.Len(t, queries, 1)
+
+	longDeadline, _ := long.Deadline()
+	assert.Equal(t, longDeadline, deadlines[0], "the batch lives until the latest deadline")
+}
+
+func TestBatchWithoutDeadlinesUsesTheTimeout(t *testing.T) {
+	repo, next, users := newRepository(t, batched.Config{Timeout: time.Minute})
+
+	start := time.Now()
+
+	_, err := repo.UsersByIDs(context.Background(), []int32{users[0].ID})
+	require.NoError(t, err)
+
+	_, deadlines := next.recorded()
+	require.Len(t, deadlines, 1)
+	assert.WithinDuration(t, start.Add(time.Minute), deadlines[0], time.Second)
+}
+
+func TestBatchReadsPrimaryForAnyCaller(t *testing.T) {
+	repo, next, users := newRepository(t, batched.Config{Wait: 20 * time.Millisecond})
+
+	var wg sync.WaitGroup
+
+	for i, ctx := range []context.Context{context.Background(), database.WithPrimary(context.Background())} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := repo.UsersByIDs(ctx, []int32{users[i].ID})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	next.mu.Lock()
+	defer next.mu.Unlock()
+
+	require.Len(t, next.queries, 1)
+	assert.True(t, next.primary[0])
+}
+
+func TestLookupsKeepTheCallersValues(t *testing.T) {
+	repo, next, users := newRepository(t, batched.Config{})
+
+	ctx := context.WithValue(context.Background(), requestKey{}, "ids")
+	_, err := repo.UsersByIDs(ctx, []int32{users[0].ID})
+	require.NoError(t, err)
+
+	ctx = context.WithValue(context.Background(), requestKey{}, "email")
+	_, err = repo.UserByEmail(ctx, users[1].Email)
+	require.NoError(t, err)
+
+	next.mu.Lock()
+	defer next.mu.Unlock()
+
+	assert.Equal(t, []any{"ids", "email"}, next.requests, "traces and request ids reach the repository")
+}
@@ -0,0 +1,89 @@
+package cached
+
+import (
+	"context"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"go.uber.org/zap"
+	"time"
+)
+
+// The repositories below change cached user fields outside of
+// UsersRepository and drop the user from the cache on success.
+
+type EmailChangeRepository struct {
+	usecases.EmailChangeRepository
+	cache  cache.Cache
+	logger *zap.Logger
+}
+
+func (r *EmailChangeRepository) ConfirmEmailChange(ctx context.Context, tokenHash string, now time.Time) (models.EmailChange, error) {
+	change, err := r.EmailChangeRepository.ConfirmEmailChange(ctx, tokenHash, now)
+	if err == nil {
+		invalidate(ctx, r.cache, r.logger, change.UserID)
+	}
+
+	return change, err
+}
+
+type PasswordRepository struct {
+	usecases.PasswordRepository
+	cache  cache.Cache
+	logger *zap.Logger
+}
+
+func (r *PasswordRepository) ChangePassword(
+	ctx context.Context,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	changedAt time.Time,
+) error {
+	defer invalidate(ctx, r.cache, r.logger, userID)
+
+	return r.PasswordRepository.ChangePassword(ctx, userID, currentHash, newHash, historySize, changedAt)
+}
+
+type PasswordResetRepository struct {
+	usecases.PasswordResetRepository
+	cache  cache.Cache
+	logger *zap.Logger
+}
+
+func (r *PasswordResetRepository) ResetPassword(
+	ctx context.Context,
+	tokenHash string,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	now time.Time,
+) error {
+	defer invalidate(ctx, r.cache, r.logger, userID)
+
+	return r.PasswordResetRepository.ResetPassword(ctx, tokenHash, userID, currentHash, newHash, historySize, now)
+}
+
+func NewEmailChangeRepository(next usecases.EmailChangeRepository, cache cache.Cache, logger *zap.Logger) *EmailChangeRepository {
+	return &EmailChangeRepository{
+		EmailChangeRepository: next,
+		cache:                 cache,
+		logger:                logger,
+	}
+}
+
+func NewPasswordRepository(next usecases.PasswordRepository, cache cache.Cache, logger *zap.Logger) *PasswordRepository {
+	return &PasswordRepository{
+		PasswordRepository: next,
+		cache:              cache,
+		logger:             logger,
+	}
+}
+
+func NewPasswordResetRepository(next usecases.PasswordResetRepository, cache cache.Cache, logger *zap.Logger) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		PasswordResetRepository: next,
+		cache:                   cache,
+		logger:                  logger,
+	}
+}
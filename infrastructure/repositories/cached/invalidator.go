@@ -0,0 +1,96 @@
+package cached
+
+import (
+	"context"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// UserChangedChannel is notified with a user id by database triggers on
+// every change of the user or of its follows.
+const UserChangedChannel = "user_changed"
+
+const (
+	minListenBackoff = time.Second
+	maxListenBackoff = 30 * time.Second
+)
+
+// Invalidator drops users from the cache when any instance changes them.
+// Notifications sent while the listener reconnects are lost, so the cache
+// TTL bounds staleness in that case.
+type Invalidator struct {
+	db     *database.Database
+	cache  cache.Cache
+	logger *zap.Logger
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (i *Invalidator) OnStart(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+
+	go i.run(ctx)
+
+	return nil
+}
+
+func (i *Invalidator) OnStop(ctx context.Context) error {
+	i.cancel()
+
+	select {
+	case <-i.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return i.cache.Close()
+}
+
+func (i *Invalidator) run(ctx context.Context) {
+	defer close(i.done)
+
+	backoff := minListenBackoff
+
+	for {
+		err := i.db.Listen(ctx, UserChangedChannel, func(payload string) {
+			backoff = minListenBackoff
+
+			id, err := strconv.Atoi(payload)
+			if err != nil {
+				i.logger.Warn("invalid user changed payload", zap.String("payload", payload))
+				return
+			}
+
+			err = i.cache.Delete(ctx, userKey(int32(id)))
+			if err != nil {
+				i.logger.Warn("failed to invalidate user in cache", zap.Int("id", id), zap.Error(err))
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		i.logger.Error("user changed listener stopped", zap.Error(err), zap.Duration("retry_in", backoff))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxListenBackoff)
+	}
+}
+
+func NewInvalidator(db *database.Database, cache cache.Cache, logger *zap.Logger) *Invalidator {
+	return &Invalidator{
+		db:     db,
+		cache:  cache,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+}
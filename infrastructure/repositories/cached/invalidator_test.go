@@ -0,0 +1,78 @@
+package cached_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/cached"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/user"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"github.com/vorotilkin/twitter-users/pkg/database/dbtest"
+	"go.uber.org/zap"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInvalidator(t *testing.T) {
+	ctx := context.Background()
+
+	db := dbtest.New(t)
+	dbtest.Truncate(t, db, "user")
+
+	repo := user.NewRepository(db)
+
+	alice, err := repo.Create(ctx, "Alice", "hash", "alice", "alice@example.com")
+	require.NoError(t, err)
+
+	bob, err := repo.Create(ctx, "Bob", "hash", "bob", "bob@example.com")
+	require.NoError(t, err)
+
+	c := cache.NewMemory(10, time.Minute)
+	invalidator := cached.NewInvalidator(db, c, zap.NewNop())
+
+	require.NoError(t, invalidator.OnStart(ctx))
+	t.Cleanup(func() { require.NoError(t, invalidator.OnStop(ctx)) })
+
+	key := func(id int32) string { return "user:" + strconv.Itoa(int(id)) }
+	cachedKeys := func() int {
+		items, err := c.GetMany(ctx, []string{key(alice.ID), key(bob.ID)})
+		require.NoError(t, err)
+
+		return len(items)
+	}
+
+	// The listener starts in the background, so notify until it is heard.
+	require.Eventually(t, func() bool {
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{key(alice.ID): []byte("{}")}))
+
+		_, err := db.Exec(ctx, `SELECT pg_notify($1, $2)`, cached.UserChangedChannel, strconv.Itoa(int(alice.ID)))
+		require.NoError(t, err)
+
+		time.Sleep(50 * time.Millisecond)
+
+		return cachedKeys() == 0
+	}, 5*time.Second, time.Millisecond)
+
+	for _, tt := range []struct {
+		name  string
+		write string
+		args  []any
+		left  int
+	}{
+		{name: "user update", write: `UPDATE "user" SET "name" = 'Alicia' WHERE "id" = $1`, args: []any{alice.ID}, left: 1},
+		{name: "follow", write: `INSERT INTO "follow" ("user_id", "following_user_id") VALUES ($1, $2)`, args: []any{alice.ID, bob.ID}},
+		{name: "unfollow", write: `DELETE FROM "follow" WHERE "user_id" = $1 AND "following_user_id" = $2`, args: []any{alice.ID, bob.ID}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, c.SetMany(ctx, map[string][]byte{key(alice.ID): []byte("{}"), key(bob.ID): []byte("{}")}))
+
+			// Changes bypass the cached repository, as a write from another
+			// instance would.
+			_, err := db.Exec(ctx, tt.write, tt.args...)
+			require.NoError(t, err)
+
+			assert.Eventually(t, func() bool { return cachedKeys() == tt.left }, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package cached
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"go.uber.org/zap"
+	"strconv"
+)
+
+const userKeyPrefix = "user:"
+
+// UsersRepository is a read-through cache for UsersByIDs. Writes going
+// through it drop the affected users right away; other writers are covered
+// by the Invalidator. Users come back without PasswordHash, cached or not,
+// so the hash is never stored in the cache; it is only read with
+// FetchPasswordHashByEmail.
+//
+// Misses are read from the primary, as a row from a lagging replica would
+// stay cached after the invalidation for it. Pinned sessions bypass the
+// cache: their writes may have gone through another instance, whose
+// invalidation has not necessarily arrived yet.
+type UsersRepository struct {
+	usecases.UsersRepository
+	cache  cache.Cache
+	logger *zap.Logger
+}
+
+func (r *UsersRepository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User, error) {
+	if database.Pinned(ctx) {
+		users, err := r.UsersRepository.UsersByIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		return lo.Map(users, func(user models.User, _ int) models.User {
+			user.PasswordHash = ""
+			return user
+		}), nil
+	}
+
+	ids = lo.Uniq(ids)
+
+	cached, err := r.cache.GetMany(ctx, lo.Map(ids, func(id int32, _ int) string { return userKey(id) }))
+	if err != nil {
+		requestid.Logger(ctx, r.logger).Warn("failed to read users from cache", zap.Error(err))
+	}
+
+	usersByID := make(map[int32]models.User, len(ids))
+	missing := make([]int32, 0, len(ids))
+
+	for _, id := range ids {
+		data, ok := cached[userKey(id)]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+
+		user := models.User{}
+
+		err = json.Unmarshal(data, &user)
+		if err != nil {
+			missing = append(missing, id)
+			continue
+		}
+
+		usersByID[id] = user
+	}
+
+	if len(missing) > 0 {
+		fetched, err := r.UsersRepository.UsersByIDs(database.WithPrimary(ctx), missing)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make(map[string][]byte, len(fetched))
+
+		for _, user := range fetched {
+			user.PasswordHash = ""
+			usersByID[user.ID] = user
+
+			data, err := json.Marshal(user)
+			if err != nil {
+				return nil, err
+			}
+
+			items[userKey(user.ID)] = data
+		}
+
+		err = r.cache.SetMany(ctx, items)
+		if err != nil {
+			requestid.Logger(ctx, r.logger).Warn("failed to write users to cache", zap.Error(err))
+		}
+	}
+
+	return lo.FilterMap(ids, func(id int32, _ int) (models.User, bool) {
+		user, ok := usersByID[id]
+		return user, ok
+	}), nil
+}
+
+func (r *UsersRepository) UpdateByID(ctx context.Context, userToUpdate models.UserOption) (bool, error) {
+	defer r.invalidate(ctx, userToUpdate.ID)
+
+	return r.UsersRepository.UpdateByID(ctx, userToUpdate)
+}
+
+func (r *UsersRepository) Follow(ctx context.Context, userID, targetUserID int32) (bool, error) {
+	defer r.invalidate(ctx, userID, targetUserID)
+
+	return r.UsersRepository.Follow(ctx, userID, targetUserID)
+}
+
+func (r *UsersRepository) Unfollow(ctx context.Context, userID, targetUserID int32) (bool, error) {
+	defer r.invalidate(ctx, userID, targetUserID)
+
+	return r.UsersRepository.Unfollow(ctx, userID, targetUserID)
+}
+
+func (r *UsersRepository) invalidate(ctx context.Context, ids ...int32) {
+	invalidate(ctx, r.cache, r.logger, ids...)
+}
+
+func invalidate(ctx context.Context, c cache.Cache, logger *zap.Logger, ids ...int32) {
+	err := c.Delete(ctx, lo.Map(ids, func(id int32, _ int) string { return userKey(id) })...)
+	if err != nil {
+		requestid.Logger(ctx, logger).Warn("failed to invalidate users in cache", zap.Int32s("ids", ids), zap.Error(err))
+	}
+}
+
+func userKey(id int32) string {
+	return userKeyPrefix + strconv.Itoa(int(id))
+}
+
+func NewUsersRepository(next usecases.UsersRepository, cache cache.Cache, logger *zap.Logger) *UsersRepository {
+	return &UsersRepository{
+		UsersRepository: next,
+		cache:           cache,
+		logger:          logger,
+	}
+}
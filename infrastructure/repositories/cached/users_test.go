@@ -0,0 +1,174 @@
+package cached_test
+
+import (
+	"context"
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/cached"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/memory"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"go.uber.org/zap"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// countingRepository counts the users read from the repository behind the
+// cache.
+type countingRepository struct {
+	*memory.UsersRepository
+	reads        int
+	replicaReads int
+}
+
+func (r *countingRepository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User, error) {
+	r.reads += len(ids)
+	if !database.ReadsPrimary(ctx) {
+		r.replicaReads += len(ids)
+	}
+
+	return r.UsersRepository.UsersByIDs(ctx, ids)
+}
+
+func newUsers(t *testing.T) (*cached.UsersRepository, *countingRepository, *cache.Memory, models.User, models.User) {
+	t.Helper()
+
+	ctx := context.Background()
+	next := &countingRepository{UsersRepository: memory.NewUsersRepository()}
+
+	alice, err := next.Create(ctx, "Alice", "alice-hash", "alice", "alice@example.com")
+	require.NoError(t, err)
+
+	bob, err := next.Create(ctx, "Bob", "bob-hash", "bob", "bob@example.com")
+	require.NoError(t, err)
+
+	c := cache.NewMemory(10, time.Minute)
+
+	return cached.NewUsersRepository(next, c, zap.NewNop()), next, c, alice, bob
+}
+
+func TestUsersByIDsReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	repo, next, _, alice, bob := newUsers(t)
+
+	users, err := repo.UsersByIDs(ctx, []int32{alice.ID})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "alice", users[0].Username)
+	assert.Equal(t, 1, next.reads)
+
+	users, err = repo.UsersByIDs(ctx, []int32{bob.ID, alice.ID, alice.ID, 404})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob", "alice"}, []string{users[0].Username, users[1].Username}, "order of ids, without duplicates or missing users")
+	assert.Equal(t, 3, next.reads, "only bob and the missing user are read")
+	assert.Zero(t, next.replicaReads, "what is cached comes from the primary")
+}
+
+func TestUsersByIDsLeavesPasswordHashOut(t *testing.T) {
+	ctx := context.Background()
+	repo, _, c, alice, _ := newUsers(t)
+
+	for range 2 {
+		users, err := repo.UsersByIDs(ctx, []int32{alice.ID})
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Empty(t, users[0].PasswordHash)
+	}
+
+	items, err := c.GetMany(ctx, []string{"user:" + strconv.Itoa(int(alice.ID))})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+
+	for _, data := range items {
+		assert.NotContains(t, string(data), "alice-hash")
+	}
+}
+
+func TestWritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name  string
+		write func(repo *cached.UsersRepository, alice, bob models.User) error
+	}{
+		{
+			name: "update",
+			write: func(repo *cached.UsersRepository, alice, _ models.User) error {
+				_, err := repo.UpdateByID(ctx, models.UserOption{ID: alice.ID, Name: mo.Some("Alicia")})
+				return err
+			},
+		},
+		{
+			name: "follow",
+			write: func(repo *cached.UsersRepository, alice, bob models.User) error {
+				_, err := repo.Follow(ctx, alice.ID, bob.ID)
+				return err
+			},
+		},
+		{
+			name: "unfollow",
+			write: func(repo *cached.UsersRepository, alice, bob models.User) error {
+				_, err := repo.Unfollow(ctx, alice.ID, bob.ID)
+				return err
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, next, _, alice, bob := newUsers(t)
+
+			_, err := repo.UsersByIDs(ctx, []int32{alice.ID, bob.ID})
+			require.NoError(t, err)
+			require.NoError(t, tt.write(repo, alice, bob))
+
+			reads := next.reads
+
+			_, err = repo.UsersByIDs(ctx, []int32{alice.ID})
+			require.NoError(t, err)
+			assert.Equal(t, reads+1, next.reads, "alice is read again")
+		})
+	}
+
+	t.Run("follow drops both users", func(t *testing.T) {
+		repo, next, _, alice, bob := newUsers(t)
+
+		_, err := repo.UsersByIDs(ctx, []int32{alice.ID, bob.ID})
+		require.NoError(t, err)
+
+		_, err = repo.Follow(ctx, alice.ID, bob.ID)
+		require.NoError(t, err)
+
+		users, err := repo.UsersByIDs(ctx, []int32{alice.ID, bob.ID})
+		require.NoError(t, err)
+		assert.Equal(t, []int32{bob.ID}, users[0].FollowingIDs)
+		assert.Equal(t, []int32{alice.ID}, users[1].FollowerIDs)
+		assert.Equal(t, 4, next.reads)
+	})
+}
+
+// passwords accepts every password change.
+type passwords struct{}
+
+func (passwords) PasswordHashes(context.Context, int32, int) ([]string, error) { return nil, nil }
+
+func (passwords) ChangePassword(context.Context, int32, string, string, int, time.Time) error {
+	return nil
+}
+
+func TestPasswordChangeInvalidates(t *testing.T) {
+	ctx := context.Background()
+	repo, next, c, alice, _ := newUsers(t)
+
+	_, err := repo.UsersByIDs(ctx, []int32{alice.ID})
+	require.NoError(t, err)
+
+	err = cached.NewPasswordRepository(passwords{}, c, zap.NewNop()).
+		ChangePassword(ctx, alice.ID, "alice-hash", "new-hash", 0, time.Now())
+	require.NoError(t, err)
+
+	_, err = repo.UsersByIDs(ctx, []int32{alice.ID})
+	require.NoError(t, err)
+	assert.Equal(t, 2, next.reads)
+}
@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"context"
+	"sort"
+)
+
+// KnownFollowers returns the users viewerID follows who follow targetID, by
+// when they followed targetID, latest first.
+func (r *UsersRepository) KnownFollowers(_ context.Context, viewerID, targetID int32, limit int) ([]int32, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var ids []int32
+
+	for followingID := range r.following[viewerID] {
+		if _, ok := r.following[followingID][targetID]; ok {
+			ids = append(ids, followingID)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		left, right := r.following[ids[i]][targetID], r.following[ids[j]][targetID]
+		if !left.Equal(right) {
+			return left.After(right)
+		}
+
+		return ids[i] < ids[j]
+	})
+
+	return ids[:min(limit, len(ids))], len(ids), nil
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+type usernameChange struct {
+	userID    int32
+	username  string
+	changedAt time.Time
+}
+
+// UserIDByUsername returns the id of the user currently holding username,
+// or zero when nobody holds it.
+func (r *UsersRepository) UserIDByUsername(_ context.Context, username string) (int32, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, id := range r.created {
+		if r.users[id].Username == username {
+			return id, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// PreviousUsernameOwner returns the id of the user who most recently gave up
+// username no earlier than since, or zero when there is none.
+func (r *UsersRepository) PreviousUsernameOwner(_ context.Context, username string, since time.Time) (int32, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.usernameHistory) - 1; i >= 0; i-- {
+		change := r.usernameHistory[i]
+		if change.changedAt.Before(since) {
+			break
+		}
+
+		if change.username == username {
+			return change.userID, nil
+		}
+	}
+
+	return 0, nil
+}
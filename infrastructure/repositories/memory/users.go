@@ -0,0 +1,250 @@
+package memory
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultNewUsersLimit = 10
+
+var (
+	errUserNotFound     = errors.New("user not found")
+	errAlreadyFollowing = errors.New("already following")
+)
+
+// UsersRepository keeps users in memory and behaves like the Postgres
+// repository, down to which lookups return zero values instead of errors.
+// It also serves as the usecases.UsernameRepository and the
+// usecases.FollowGraphRepository of the users it holds.
+// It is safe for concurrent use.
+type UsersRepository struct {
+	mu     sync.RWMutex
+	nextID int32
+	users  map[int32]*models.User
+	// created lists ids from the oldest user to the newest.
+	created []int32
+	// following maps a user to the users it follows and when it followed
+	// them.
+	following map[int32]map[int32]time.Time
+	// usernameHistory lists given up usernames from the oldest change.
+	usernameHistory []usernameChange
+}
+
+func (r *UsersRepository) Create(_ context.Context, name, passwordHash, username, email string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return models.User{}, models.ErrEmailTaken
+		}
+	}
+
+	r.nextID++
+	user := &models.User{
+		ID:           r.nextID,
+		Name:         name,
+		PasswordHash: passwordHash,
+		Username:     username,
+		Email:        email,
+	}
+
+	r.users[user.ID] = user
+	r.created = append(r.created, user.ID)
+
+	return models.User{
+		ID:           user.ID,
+		Name:         user.Name,
+		PasswordHash: user.PasswordHash,
+		Username:     user.Username,
+		Email:        user.Email,
+	}, nil
+}
+
+func (r *UsersRepository) FetchPasswordHashByEmail(_ context.Context, email string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.byEmail(email)
+	if !ok {
+		return "", nil
+	}
+
+	return user.PasswordHash, nil
+}
+
+func (r *UsersRepository) UserByEmail(_ context.Context, email string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.byEmail(email)
+	if !ok {
+		return models.User{}, nil
+	}
+
+	return *user, nil
+}
+
+func (r *UsersRepository) byEmail(email string) (*models.User, bool) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *UsersRepository) UsersByIDs(_ context.Context, ids []int32) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(ids))
+
+	for _, id := range lo.Uniq(ids) {
+		if _, ok := r.users[id]; ok {
+			users = append(users, r.withFollows(id))
+		}
+	}
+
+	return users, nil
+}
+
+func (r *UsersRepository) UpdateByID(_ context.Context, userToUpdate models.UserOption) (bool, error) {
+	fields := lo.Uniq(userToUpdate.Fields())
+	if len(fields) == 0 {
+		return false, models.ErrNothingToUpdate
+	}
+
+	for _, field := range fields {
+		if _, ok := models.ParseUserField(string(field)); !ok {
+			return false, errors.Wrapf(models.ErrUnknownUserField, "field %s", field)
+		}
+
+		if userToUpdate.Value(field).IsAbsent() && !field.Nullable() {
+			return false, errors.Wrapf(models.ErrFieldNotNullable, "field %s", field)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userToUpdate.ID]
+	if !ok {
+		return false, nil
+	}
+
+	if lo.Contains(fields, models.UserFieldUsername) && userToUpdate.Username.OrEmpty() != user.Username {
+		r.usernameHistory = append(r.usernameHistory, usernameChange{
+			userID:    user.ID,
+			username:  user.Username,
+			changedAt: time.Now().UTC(),
+		})
+	}
+
+	for _, field := range fields {
+		value := userToUpdate.Value(field).OrEmpty()
+
+		switch field {
+		case models.UserFieldName:
+			user.Name = value
+		case models.UserFieldUsername:
+			user.Username = value
+		case models.UserFieldBio:
+			user.Bio = value
+		case models.UserFieldProfileImage:
+			user.ProfileImage = value
+		case models.UserFieldCoverImage:
+			user.CoverImage = value
+		}
+	}
+
+	return true, nil
+}
+
+func (r *UsersRepository) Follow(_ context.Context, userID, targetUserID int32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.users[userID] == nil || r.users[targetUserID] == nil {
+		return false, errors.Wrapf(errUserNotFound, "follow %d -> %d", userID, targetUserID)
+	}
+
+	following := r.following[userID]
+	if following == nil {
+		following = make(map[int32]time.Time)
+		r.following[userID] = following
+	}
+
+	if _, ok := following[targetUserID]; ok {
+		return false, errors.Wrapf(errAlreadyFollowing, "follow %d -> %d", userID, targetUserID)
+	}
+
+	following[targetUserID] = time.Now()
+
+	return true, nil
+}
+
+func (r *UsersRepository) Unfollow(_ context.Context, userID, targetUserID int32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.following[userID][targetUserID]; !ok {
+		return false, nil
+	}
+
+	delete(r.following[userID], targetUserID)
+
+	return true, nil
+}
+
+func (r *UsersRepository) NewUsers(_ context.Context, limit int32) ([]models.User, error) {
+	if limit == 0 {
+		limit = defaultNewUsersLimit
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, min(int(limit), len(r.created)))
+
+	for i := len(r.created) - 1; i >= 0 && len(users) < int(limit); i-- {
+		users = append(users, r.withFollows(r.created[i]))
+	}
+
+	return users, nil
+}
+
+// withFollows copies the user with the ids it follows and is followed by,
+// nil rather than empty when there are none, as ARRAY_AGG returns NULL.
+func (r *UsersRepository) withFollows(id int32) models.User {
+	user := *r.users[id]
+	user.FollowingIDs, user.FollowerIDs = nil, nil
+
+	for followingID := range r.following[id] {
+		user.FollowingIDs = append(user.FollowingIDs, followingID)
+	}
+
+	for followerID, following := range r.following {
+		if _, ok := following[id]; ok {
+			user.FollowerIDs = append(user.FollowerIDs, followerID)
+		}
+	}
+
+	sort.Slice(user.FollowingIDs, func(i, j int) bool { return user.FollowingIDs[i] < user.FollowingIDs[j] })
+	sort.Slice(user.FollowerIDs, func(i, j int) bool { return user.FollowerIDs[i] < user.FollowerIDs[j] })
+
+	return user
+}
+
+func NewUsersRepository() *UsersRepository {
+	return &UsersRepository{
+		users:     make(map[int32]*models.User),
+		following: make(map[int32]map[int32]time.Time),
+	}
+}
@@ -0,0 +1,21 @@
+package memory_test
+
+import (
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/memory"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/repotest"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"testing"
+)
+
+func TestUsersRepository(t *testing.T) {
+	repotest.UsersRepository(t, func(*testing.T) usecases.UsersRepository {
+		return memory.NewUsersRepository()
+	})
+}
+
+func TestFollowGraphRepository(t *testing.T) {
+	repotest.FollowGraphRepository(t, func(*testing.T) (usecases.UsersRepository, usecases.FollowGraphRepository) {
+		repo := memory.NewUsersRepository()
+		return repo, repo
+	})
+}
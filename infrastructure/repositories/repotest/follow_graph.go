@@ -0,0 +1,66 @@
+package repotest
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"testing"
+	"time"
+)
+
+// FollowGraphRepository runs the contract of usecases.FollowGraphRepository.
+// newRepository returns an empty repository as both interfaces and is called
+// once per subtest.
+func FollowGraphRepository(
+	t *testing.T,
+	newRepository func(t *testing.T) (usecases.UsersRepository, usecases.FollowGraphRepository),
+) {
+	t.Run("KnownFollowers", func(t *testing.T) {
+		users, graph := newRepository(t)
+		ctx := context.Background()
+
+		viewer := create(t, users, "viewer")
+		target := create(t, users, "target")
+		alice := create(t, users, "alice")
+		bob := create(t, users, "bob")
+		carol := create(t, users, "carol")
+		stranger := create(t, users, "stranger")
+
+		follow := func(userID, targetUserID int32) {
+			t.Helper()
+
+			_, err := users.Follow(ctx, userID, targetUserID)
+			require.NoError(t, err)
+		}
+
+		for _, id := range []int32{alice.ID, bob.ID, carol.ID} {
+			follow(viewer.ID, id)
+		}
+
+		// Follows are ordered by time, which some stores only keep to the
+		// microsecond.
+		for _, id := range []int32{bob.ID, stranger.ID, alice.ID} {
+			follow(id, target.ID)
+			time.Sleep(time.Millisecond)
+		}
+
+		// Carol follows the viewer, not the target.
+		follow(carol.ID, viewer.ID)
+
+		ids, total, err := graph.KnownFollowers(ctx, viewer.ID, target.ID, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []int32{alice.ID, bob.ID}, ids, "latest follower of the target first")
+		assert.Equal(t, 2, total)
+
+		ids, total, err = graph.KnownFollowers(ctx, viewer.ID, target.ID, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int32{alice.ID}, ids)
+		assert.Equal(t, 2, total, "total ignores the limit")
+
+		ids, total, err = graph.KnownFollowers(ctx, stranger.ID, target.ID, 10)
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+		assert.Zero(t, total)
+	})
+}
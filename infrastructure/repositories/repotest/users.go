@@ -0,0 +1,253 @@
+// Package repotest holds the contract every repository implementation must
+// satisfy, shared by the tests of the implementations.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"github.com/samber/lo"
+	"github.com/samber/mo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"sync"
+	"testing"
+)
+
+// UsersRepository runs the contract of usecases.UsersRepository. newRepository
+// returns an empty repository and is called once per subtest.
+func UsersRepository(t *testing.T, newRepository func(t *testing.T) usecases.UsersRepository) {
+	t.Run("Create", func(t *testing.T) {
+		repo := newRepository(t)
+		ctx := context.Background()
+
+		user, err := repo.Create(ctx, "Alice", "hash", "alice", "alice@example.com")
+		require.NoError(t, err)
+		assert.Positive(t, user.ID)
+		assert.Equal(t, "Alice", user.Name)
+		assert.Equal(t, "hash", user.PasswordHash)
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, "alice@example.com", user.Email)
+
+		other, err := repo.Create(ctx, "Bob", "hash", "bob", "bob@example.com")
+		require.NoError(t, err)
+		assert.NotEqual(t, user.ID, other.ID)
+
+		_, err = repo.Create(ctx, "Alice again", "hash", "alice2", "alice@example.com")
+		assert.ErrorIs(t, err, models.ErrEmailTaken)
+	})
+
+	t.Run("CreateConcurrently", func(t *testing.T) {
+		repo := newRepository(t)
+
+		const n = 20
+
+		ids := make([]int32, n)
+
+		var wg sync.WaitGroup
+
+		for i := range n {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				user, err := repo.Create(context.Background(), "User", "hash", fmt.Sprintf("user%d", i), fmt.Sprintf("user%d@example.com", i))
+				assert.NoError(t, err)
+
+				ids[i] = user.ID
+			}()
+		}
+
+		wg.Wait()
+		assert.Len(t, lo.Uniq(ids), n)
+	})
+
+	t.Run("FetchPasswordHashByEmail", func(t *testing.T) {
+		repo := newRepository(t)
+		ctx := context.Background()
+
+		_, err := repo.Create(ctx, "Alice", "secret-hash", "alice", "alice@example.com")
+		require.NoError(t, err)
+
+		hash, err := repo.FetchPasswordHashByEmail(ctx, "alice@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "secret-hash", hash)
+
+		hash, err = repo.FetchPasswordHashByEmail(ctx, "nobody@example.com")
+		require.NoError(t, err)
+		assert.Empty(t, hash)
+	})
+
+	t.Run("UserByEmail", func(t *testing.T) {
+		repo := newRepository(t)
+		ctx := context.Background()
+
+		created, err := repo.Create(ctx, "Alice", "hash", "alice", "alice@example.com")
+		require.NoError(t, err)
+
+		user, err := repo.UserByEmail(ctx, "alice@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, user.ID)
+		assert.Equal(t, "alice", user.Username)
+
+		user, err = repo.UserByEmail(ctx, "nobody@example.com")
+		require.NoError(t, err)
+		assert.Zero(t, user.ID)
+	})
+
+	t.Run("UsersByIDs", func(t *testing.T) {
+		repo := newRepository(t)
+		ctx := context.Background()
+
+		alice := create(t, repo, "alice")
+		bob := create(t, repo, "bob")
+		create(t, repo, "carol")
+
+		users, err := repo.UsersByIDs(ctx, []int32{alice.ID, bob.ID, alice.ID, 1 << 30})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []int32{alice.ID, bob.ID}, ids(users))
+
+		users, err = repo.UsersByIDs(ctx, []int32{1 << 30})
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	})
+
+	t.Run("UpdateByID", func(t *testing.T) {
+		repo := newRepository(t)
+		ctx := context.Background()
+
+		alice := create(t, repo, "alice")
+
+		ok, err := repo.UpdateByID(ctx, models.UserOption{
+			ID:       alice.ID,
+			Name:     mo.Some("Alice Liddell"),
+			Username: mo.Some("liddell"),
+			Bio:      mo.Some("curious"),
+		})
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		user := byID(t, repo, alice.ID)
+		assert.Equal(t, "Alice Liddell", user.Name)
+		assert.Equal(t, "liddell", user.Username)
+		assert.Equal(t, "curious", user.Bio)
+
+		// A masked nullable field without a value is cleared, the others are
+		// left alone.
+		ok, err = repo.UpdateByID(ctx, models.UserOption{
+			ID:           alice.ID,
+			ProfileImage: mo.Some("avatar.png"),
+			Mask:         []models.UserField{models.UserFieldBio, models.UserFieldProfileImage},
+		})
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		user = byID(t, repo, alice.ID)
+		assert.Empty(t, user.Bio)
+		assert.Equal(t, "avatar.png", user.ProfileImage)
+		assert.Equal(t, "Alice Liddell", user.Name)
+
+		_, err = repo.UpdateByID(ctx, models.UserOption{ID: alice.ID})
+		assert.ErrorIs(t, err, models.ErrNothingToUpdate)
+
+		_, err = repo.UpdateByID(ctx, models.UserOption{ID: alice.ID, Mask: []models.UserField{models.UserFieldName}})
+		assert.ErrorIs(t, err, models.ErrFieldNotNullable)
+
+		ok, err = repo.UpdateByID(ctx, models.UserOption{ID: 1 << 30, Name: mo.Some("Nobody")})
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("FollowAndUnfollow", func(t *testing.T) {
+		repo := newRepository(t)
+		ctx := context.Background()
+
+		alice := create(t, repo, "alice")
+		bob := create(t, repo, "bob")
+		carol := create(t, repo, "carol")
+
+		for _, target := range []int32{bob.ID, carol.ID} {
+			ok, err := repo.Follow(ctx, alice.ID, target)
+			require.NoError(t, err)
+			assert.True(t, ok)
+		}
+
+		ok, err := repo.Follow(ctx, carol.ID, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.ElementsMatch(t, []int32{bob.ID, carol.ID}, byID(t, repo, alice.ID).FollowingIDs)
+		assert.Empty(t, byID(t, repo, alice.ID).FollowerIDs)
+		assert.ElementsMatch(t, []int32{alice.ID, carol.ID}, byID(t, repo, bob.ID).FollowerIDs)
+
+		_, err = repo.Follow(ctx, alice.ID, bob.ID)
+		assert.Error(t, err, "following twice")
+
+		_, err = repo.Follow(ctx, alice.ID, 1<<30)
+		assert.Error(t, err, "following an unknown user")
+
+		ok, err = repo.Unfollow(ctx, alice.ID, bob.ID)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = repo.Unfollow(ctx, alice.ID, bob.ID)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.Equal(t, []int32{carol.ID}, byID(t, repo, alice.ID).FollowingIDs)
+		assert.Equal(t, []int32{carol.ID}, byID(t, repo, bob.ID).FollowerIDs)
+	})
+
+	t.Run("NewUsers", func(t *testing.T) {
+		repo := newRepository(t)
+		ctx := context.Background()
+
+		users, err := repo.NewUsers(ctx, 5)
+		require.NoError(t, err)
+		assert.Empty(t, users)
+
+		var created []int32
+		for i := range 12 {
+			created = append(created, create(t, repo, fmt.Sprintf("user%d", i)).ID)
+		}
+
+		newest := lo.Reverse(created)
+
+		users, err = repo.NewUsers(ctx, 3)
+		require.NoError(t, err)
+		assert.Equal(t, newest[:3], ids(users))
+
+		users, err = repo.NewUsers(ctx, 0)
+		require.NoError(t, err)
+		assert.Equal(t, newest[:10], ids(users), "zero limit defaults to 10")
+
+		users, err = repo.NewUsers(ctx, 100)
+		require.NoError(t, err)
+		assert.Equal(t, newest, ids(users))
+	})
+}
+
+func create(t *testing.T, repo usecases.UsersRepository, username string) models.User {
+	t.Helper()
+
+	user, err := repo.Create(context.Background(), username, "hash", username, username+"@example.com")
+	require.NoError(t, err)
+
+	return user
+}
+
+func byID(t *testing.T, repo usecases.UsersRepository, id int32) models.User {
+	t.Helper()
+
+	users, err := repo.UsersByIDs(context.Background(), []int32{id})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+
+	return users[0]
+}
+
+func ids(users []models.User) []int32 {
+	return lo.Map(users, func(user models.User, _ int) int32 { return user.ID })
+}
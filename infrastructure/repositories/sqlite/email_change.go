@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	pkgSqlite "github.com/vorotilkin/twitter-users/pkg/sqlite"
+	"time"
+)
+
+// SaveEmailChange stores a pending email change, replacing any previous
+// pending change of the user.
+func (r *Repository) SaveEmailChange(ctx context.Context, userID int32, newEmail, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+INSERT INTO "email_change" ("user_id", "new_email", "token_hash", "expires_at", "created_at")
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT ("user_id") DO UPDATE SET
+  "new_email" = "excluded"."new_email",
+  "token_hash" = "excluded"."token_hash",
+  "expires_at" = "excluded"."expires_at",
+  "created_at" = "excluded"."created_at"`,
+		userID, newEmail, tokenHash, expiresAt.UTC(), utcNow())
+
+	return err
+}
+
+// ConfirmEmailChange applies the pending change matching tokenHash and
+// returns both the old and the new address.
+func (r *Repository) ConfirmEmailChange(ctx context.Context, tokenHash string, now time.Time) (models.EmailChange, error) {
+	now = now.UTC()
+	change := models.EmailChange{}
+
+	err := r.db.InTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			`SELECT "user_id", "new_email" FROM "email_change" WHERE "token_hash" = ? AND "expires_at" > ?`,
+			tokenHash, now).Scan(&change.UserID, &change.NewEmail)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.ErrTokenNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT "email" FROM "user" WHERE "id" = ?`, change.UserID).Scan(&change.OldEmail)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE "user" SET "email" = ?, "email_verified" = ?, "updated_at" = ? WHERE "id" = ?`,
+			change.NewEmail, now, now, change.UserID)
+		if pkgSqlite.IsUniqueViolation(err) {
+			return models.ErrEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM "email_change" WHERE "user_id" = ?`, change.UserID)
+
+		return err
+	})
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+
+	return change, nil
+}
@@ -0,0 +1,40 @@
+package sqlite
+
+import "context"
+
+// KnownFollowers joins the follows of the viewer with the followers of the
+// target through the primary key of follow, as the Postgres repository does.
+func (r *Repository) KnownFollowers(ctx context.Context, viewerID, targetID int32, limit int) ([]int32, int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+SELECT "target_followers"."user_id", COUNT(*) OVER ()
+FROM "follow" AS "viewer_follows"
+JOIN "follow" AS "target_followers"
+  ON "target_followers"."user_id" = "viewer_follows"."following_user_id"
+  AND "target_followers"."following_user_id" = ?
+WHERE "viewer_follows"."user_id" = ?
+ORDER BY "target_followers"."created_at" DESC, "target_followers"."user_id"
+LIMIT ?`, targetID, viewerID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var (
+		ids   []int32
+		total int
+	)
+
+	for rows.Next() {
+		var id int32
+
+		err = rows.Scan(&id, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, total, rows.Err()
+}
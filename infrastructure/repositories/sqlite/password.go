@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"time"
+)
+
+// PasswordHashes returns the current password hash of the user followed by
+// up to limit-1 previous hashes, newest first. It returns nothing when the
+// user does not exist.
+func (r *Repository) PasswordHashes(ctx context.Context, userID int32, limit int) ([]string, error) {
+	var current string
+
+	err := r.db.QueryRowContext(ctx, `SELECT "password_hash" FROM "user" WHERE "id" = ?`, userID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []string{current}
+	if limit <= 1 {
+		return hashes, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+SELECT "password_hash" FROM "password_history"
+WHERE "user_id" = ?
+ORDER BY "created_at" DESC, "id" DESC
+LIMIT ?`, userID, limit-1)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+
+		err = rows.Scan(&hash)
+		if err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
+
+// ChangePassword replaces currentHash with newHash, moves currentHash into
+// the password history and keeps at most historySize-1 history entries.
+// It fails with models.ErrPasswordChanged when the stored hash no longer
+// matches currentHash.
+func (r *Repository) ChangePassword(
+	ctx context.Context,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	changedAt time.Time,
+) error {
+	return r.db.InTx(ctx, func(tx *sql.Tx) error {
+		return changePassword(ctx, tx, userID, currentHash, newHash, historySize, changedAt)
+	})
+}
+
+func changePassword(
+	ctx context.Context,
+	tx *sql.Tx,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	changedAt time.Time,
+) error {
+	changedAt = changedAt.UTC()
+
+	result, err := tx.ExecContext(ctx, `
+UPDATE "user" SET "password_hash" = ?, "password_changed_at" = ?, "updated_at" = ?
+WHERE "id" = ? AND "password_hash" = ?`,
+		newHash, changedAt, changedAt, userID, currentHash)
+	if err != nil {
+		return err
+	}
+
+	updated, err := affected(result)
+	if err != nil {
+		return err
+	}
+
+	if !updated {
+		return models.ErrPasswordChanged
+	}
+
+	return appendPasswordHistory(ctx, tx, userID, currentHash, historySize)
+}
+
+func appendPasswordHistory(ctx context.Context, tx *sql.Tx, userID int32, hash string, historySize int) error {
+	if historySize <= 1 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO "password_history" ("user_id", "password_hash", "created_at") VALUES (?, ?, ?)`,
+		userID, hash, utcNow())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+DELETE FROM "password_history"
+WHERE "user_id" = ? AND "id" NOT IN (
+  SELECT "id" FROM "password_history"
+  WHERE "user_id" = ?
+  ORDER BY "created_at" DESC, "id" DESC
+  LIMIT ?
+)`, userID, userID, historySize-1)
+
+	return err
+}
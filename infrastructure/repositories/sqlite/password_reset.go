@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"time"
+)
+
+const activeResetToken = `"token_hash" = ? AND "used_at" IS NULL AND "expires_at" > ?`
+
+func (r *Repository) SavePasswordResetToken(ctx context.Context, userID int32, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO "password_reset_token" ("token_hash", "user_id", "expires_at", "created_at") VALUES (?, ?, ?, ?)`,
+		tokenHash, userID, expiresAt.UTC(), utcNow())
+
+	return err
+}
+
+// PasswordResetUserID returns the owner of an unused and unexpired token.
+func (r *Repository) PasswordResetUserID(ctx context.Context, tokenHash string, now time.Time) (int32, error) {
+	var userID int32
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT "user_id" FROM "password_reset_token" WHERE `+activeResetToken,
+		tokenHash, now.UTC()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, models.ErrTokenNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword consumes the token, revokes every other outstanding reset
+// token of the user and changes the password as ChangePassword does.
+func (r *Repository) ResetPassword(
+	ctx context.Context,
+	tokenHash string,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	now time.Time,
+) error {
+	now = now.UTC()
+
+	return r.db.InTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE "password_reset_token" SET "used_at" = ? WHERE `+activeResetToken+` AND "user_id" = ?`,
+			now, tokenHash, now, userID)
+		if err != nil {
+			return err
+		}
+
+		consumed, err := affected(result)
+		if err != nil {
+			return err
+		}
+
+		if !consumed {
+			return models.ErrTokenNotFound
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE "password_reset_token" SET "used_at" = ? WHERE "user_id" = ? AND "used_at" IS NULL`,
+			now, userID)
+		if err != nil {
+			return err
+		}
+
+		return changePassword(ctx, tx, userID, currentHash, newHash, historySize, now)
+	})
+}
+
+// DeleteExpiredTokens removes used or expired password reset tokens and
+// expired email changes, returning the number of deleted rows.
+func (r *Repository) DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	now = now.UTC()
+
+	resetResult, err := r.db.ExecContext(ctx,
+		`DELETE FROM "password_reset_token" WHERE "expires_at" <= ? OR "used_at" IS NOT NULL`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	emailResult, err := r.db.ExecContext(ctx, `DELETE FROM "email_change" WHERE "expires_at" <= ?`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	resetDeleted, err := resetResult.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	emailDeleted, err := emailResult.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return resetDeleted + emailDeleted, nil
+}
@@ -0,0 +1,323 @@
+// Package sqlite implements the repositories of the user package on SQLite,
+// for running the service without a database server.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	pkgSqlite "github.com/vorotilkin/twitter-users/pkg/sqlite"
+	"strings"
+	"time"
+)
+
+const defaultNewUsersLimit = 10
+
+const userColumns = `"id", "name", "password_hash", "username", "email", "bio", "profile_image", "cover_image", "password_changed_at"`
+
+type Repository struct {
+	db *pkgSqlite.DB
+}
+
+func (r *Repository) UpdateByID(ctx context.Context, userToUpdate models.UserOption) (bool, error) {
+	assignments, args, err := assignmentsToUpdate(userToUpdate)
+	if err != nil {
+		return false, err
+	}
+	if len(assignments) == 0 {
+		return false, models.ErrNothingToUpdate
+	}
+
+	query := `UPDATE "user" SET ` + strings.Join(assignments, ", ") + ` WHERE "id" = ?`
+	args = append(args, userToUpdate.ID)
+
+	updated := false
+
+	err = r.db.InTx(ctx, func(tx *sql.Tx) error {
+		var oldUsername string
+
+		err := tx.QueryRowContext(ctx, `SELECT "username" FROM "user" WHERE "id" = ?`, userToUpdate.ID).Scan(&oldUsername)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		updated, err = affected(result)
+		if err != nil || !updated {
+			return err
+		}
+
+		if !lo.Contains(userToUpdate.Fields(), models.UserFieldUsername) || userToUpdate.Username.OrEmpty() == oldUsername {
+			return nil
+		}
+
+		return appendUsernameHistory(ctx, tx, userToUpdate.ID, oldUsername)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return updated, nil
+}
+
+func assignmentsToUpdate(userToUpdate models.UserOption) ([]string, []any, error) {
+	fields := lo.Uniq(userToUpdate.Fields())
+	assignments := make([]string, 0, len(fields))
+	args := make([]any, 0, len(fields))
+
+	for _, field := range fields {
+		value := userToUpdate.Value(field)
+		if value.IsAbsent() && !field.Nullable() {
+			return nil, nil, errors.Wrapf(models.ErrFieldNotNullable, "field %s", field)
+		}
+
+		switch field {
+		case models.UserFieldName:
+			assignments = append(assignments, `"name" = ?`)
+		case models.UserFieldUsername:
+			assignments = append(assignments, `"username" = ?`)
+		case models.UserFieldBio:
+			assignments = append(assignments, `"bio" = ?`)
+		case models.UserFieldProfileImage:
+			assignments = append(assignments, `"profile_image" = ?`)
+		case models.UserFieldCoverImage:
+			assignments = append(assignments, `"cover_image" = ?`)
+		default:
+			return nil, nil, errors.Wrapf(models.ErrUnknownUserField, "field %s", field)
+		}
+
+		args = append(args, value.ToPointer())
+	}
+
+	return assignments, args, nil
+}
+
+func (r *Repository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User, error) {
+	ids = lo.Uniq(ids)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT ` + userColumns + ` FROM "user" WHERE "id" IN (` + placeholders(len(ids)) + `)`
+
+	return r.users(ctx, query, lo.ToAnySlice(ids)...)
+}
+
+func (r *Repository) UserByEmail(ctx context.Context, email string) (models.User, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM "user" WHERE "email" = ?`, email)
+
+	user, err := scanUser(row)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *Repository) Create(ctx context.Context, name, passwordHash, username, email string) (models.User, error) {
+	row := r.db.QueryRowContext(ctx, `
+INSERT INTO "user" ("name", "password_hash", "username", "email", "created_at", "updated_at")
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING `+userColumns, name, passwordHash, username, email, utcNow(), utcNow())
+
+	user, err := scanUser(row)
+	if pkgSqlite.IsUniqueViolation(err) {
+		return models.User{}, models.ErrEmailTaken
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r *Repository) FetchPasswordHashByEmail(ctx context.Context, email string) (string, error) {
+	var passwordHash string
+
+	err := r.db.QueryRowContext(ctx, `SELECT "password_hash" FROM "user" WHERE "email" = ?`, email).Scan(&passwordHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	return passwordHash, nil
+}
+
+func (r *Repository) Follow(ctx context.Context, userID, targetUserID int32) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO "follow" ("user_id", "following_user_id", "created_at") VALUES (?, ?, ?)`,
+		userID, targetUserID, utcNow())
+	if err != nil {
+		return false, err
+	}
+
+	return affected(result)
+}
+
+func (r *Repository) Unfollow(ctx context.Context, userID, targetUserID int32) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM "follow" WHERE "user_id" = ? AND "following_user_id" = ?`,
+		userID, targetUserID)
+	if err != nil {
+		return false, err
+	}
+
+	return affected(result)
+}
+
+func (r *Repository) NewUsers(ctx context.Context, limit int32) ([]models.User, error) {
+	if limit == 0 {
+		limit = defaultNewUsersLimit
+	}
+
+	// created_at is only as precise as the clock; the id breaks ties between
+	// users created together.
+	query := `SELECT ` + userColumns + ` FROM "user" ORDER BY "created_at" DESC, "id" DESC LIMIT ?`
+
+	return r.users(ctx, query, limit)
+}
+
+// users runs a query selecting userColumns and fills in the follows of the
+// users it returns.
+func (r *Repository) users(ctx context.Context, query string, args ...any) ([]models.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var users []models.User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	// The only connection must be released before the next query.
+	rows.Close()
+
+	err = r.hydrateFollows(ctx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// hydrateFollows sets the ids each user follows and is followed by, leaving
+// them nil when there are none, as ARRAY_AGG does on Postgres.
+func (r *Repository) hydrateFollows(ctx context.Context, users []models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := lo.ToAnySlice(lo.Map(users, func(user models.User, _ int) int32 { return user.ID }))
+	in := placeholders(len(ids))
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT "user_id", "following_user_id" FROM "follow" WHERE "user_id" IN (`+in+`) OR "following_user_id" IN (`+in+`)`,
+		append(ids, ids...)...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	byID := make(map[int32]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+
+	for rows.Next() {
+		var userID, followingUserID int32
+
+		err = rows.Scan(&userID, &followingUserID)
+		if err != nil {
+			return err
+		}
+
+		if user, ok := byID[userID]; ok {
+			user.FollowingIDs = append(user.FollowingIDs, followingUserID)
+		}
+
+		if user, ok := byID[followingUserID]; ok {
+			user.FollowerIDs = append(user.FollowerIDs, userID)
+		}
+	}
+
+	return rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (models.User, error) {
+	var (
+		user                          models.User
+		bio, profileImage, coverImage sql.NullString
+		passwordChangedAt             sql.NullTime
+	)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.PasswordHash,
+		&user.Username,
+		&user.Email,
+		&bio,
+		&profileImage,
+		&coverImage,
+		&passwordChangedAt,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user.Bio = bio.String
+	user.ProfileImage = profileImage.String
+	user.CoverImage = coverImage.String
+	user.PasswordChangedAt = passwordChangedAt.Time
+
+	return user, nil
+}
+
+func affected(result sql.Result) (bool, error) {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// utcNow is the time stored for rows written by the repository, in UTC like
+// the CURRENT_TIMESTAMP defaults, so that stored times compare as text.
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+func NewRepository(db *pkgSqlite.DB) *Repository {
+	return &Repository{db: db}
+}
@@ -0,0 +1,37 @@
+package sqlite_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/repotest"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/sqlite"
+	pkgSqlite "github.com/vorotilkin/twitter-users/pkg/sqlite"
+	sqliteMigrations "github.com/vorotilkin/twitter-users/schema/migrations/sqlite"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestUsersRepository(t *testing.T) {
+	repotest.UsersRepository(t, func(t *testing.T) usecases.UsersRepository {
+		return newRepository(t)
+	})
+}
+
+func TestFollowGraphRepository(t *testing.T) {
+	repotest.FollowGraphRepository(t, func(t *testing.T) (usecases.UsersRepository, usecases.FollowGraphRepository) {
+		repo := newRepository(t)
+		return repo, repo
+	})
+}
+
+func newRepository(t *testing.T) *sqlite.Repository {
+	db, err := pkgSqlite.Open(pkgSqlite.Config{Path: pkgSqlite.MemoryPath})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	err = pkgSqlite.Migrate(context.Background(), db, zap.NewNop(), sqliteMigrations.FS)
+	require.NoError(t, err)
+
+	return sqlite.NewRepository(db)
+}
@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// UserIDByUsername returns the id of the user currently holding username,
+// or zero when nobody holds it.
+func (r *Repository) UserIDByUsername(ctx context.Context, username string) (int32, error) {
+	var userID int32
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT "id" FROM "user" WHERE "username" = ? ORDER BY "id" LIMIT 1`,
+		username).Scan(&userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// PreviousUsernameOwner returns the id of the user who most recently gave up
+// username no earlier than since, or zero when there is none.
+func (r *Repository) PreviousUsernameOwner(ctx context.Context, username string, since time.Time) (int32, error) {
+	var userID int32
+
+	err := r.db.QueryRowContext(ctx, `
+SELECT "user_id" FROM "username_history"
+WHERE "username" = ? AND "changed_at" >= ?
+ORDER BY "changed_at" DESC, "id" DESC
+LIMIT 1`, username, since.UTC()).Scan(&userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func appendUsernameHistory(ctx context.Context, tx *sql.Tx, userID int32, username string) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO "username_history" ("user_id", "username", "changed_at") VALUES (?, ?, ?)`,
+		userID, username, utcNow())
+
+	return err
+}
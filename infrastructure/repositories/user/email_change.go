@@ -0,0 +1,117 @@
+package user
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/model"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/table"
+	"time"
+)
+
+const userEmailConstraint = "user_pk"
+
+// SaveEmailChange stores a pending email change, replacing any previous
+// pending change of the user.
+func (r *Repository) SaveEmailChange(ctx context.Context, userID int32, newEmail, tokenHash string, expiresAt time.Time) error {
+	ctx = database.WithQueryName(ctx, "user.SaveEmailChange")
+
+	query, args := table.EmailChange.
+		INSERT(
+			table.EmailChange.UserID,
+			table.EmailChange.NewEmail,
+			table.EmailChange.TokenHash,
+			table.EmailChange.ExpiresAt,
+		).
+		MODEL(model.EmailChange{
+			UserID:    userID,
+			NewEmail:  newEmail,
+			TokenHash: tokenHash,
+			ExpiresAt: expiresAt,
+		}).
+		ON_CONFLICT(table.EmailChange.UserID).
+		DO_UPDATE(postgres.SET(
+			table.EmailChange.NewEmail.SET(table.EmailChange.EXCLUDED.NewEmail),
+			table.EmailChange.TokenHash.SET(table.EmailChange.EXCLUDED.TokenHash),
+			table.EmailChange.ExpiresAt.SET(table.EmailChange.EXCLUDED.ExpiresAt),
+			table.EmailChange.CreatedAt.SET(table.EmailChange.EXCLUDED.CreatedAt),
+		)).
+		Sql()
+
+	_, err := r.conn.Exec(ctx, query, args...)
+
+	return err
+}
+
+// ConfirmEmailChange applies the pending change matching tokenHash and
+// returns both the old and the new address.
+func (r *Repository) ConfirmEmailChange(ctx context.Context, tokenHash string, now time.Time) (models.EmailChange, error) {
+	ctx = database.WithQueryName(ctx, "user.ConfirmEmailChange")
+
+	change := models.EmailChange{}
+
+	err := r.conn.InTx(ctx, func(tx *database.Tx) error {
+		query, args := table.EmailChange.
+			SELECT(table.EmailChange.UserID, table.EmailChange.NewEmail).
+			WHERE(
+				table.EmailChange.TokenHash.EQ(postgres.String(tokenHash)).
+					AND(table.EmailChange.ExpiresAt.GT(postgres.TimestampT(now))),
+			).
+			FOR(postgres.UPDATE()).
+			Sql()
+
+		err := tx.QueryRow(ctx, query, args...).Scan(&change.UserID, &change.NewEmail)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ErrTokenNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query, args = table.User.
+			SELECT(table.User.Email).
+			WHERE(table.User.ID.EQ(postgres.Int(int64(change.UserID)))).
+			FOR(postgres.UPDATE()).
+			Sql()
+
+		err = tx.QueryRow(ctx, query, args...).Scan(&change.OldEmail)
+		if err != nil {
+			return err
+		}
+
+		query, args = table.User.
+			UPDATE(table.User.Email, table.User.EmailVerified, table.User.UpdatedAt).
+			MODEL(model.User{
+				Email:         change.NewEmail,
+				EmailVerified: &now,
+				UpdatedAt:     now,
+			}).
+			WHERE(table.User.ID.EQ(postgres.Int(int64(change.UserID)))).
+			Sql()
+
+		_, err = tx.Exec(ctx, query, args...)
+		if database.IsUniqueViolation(err, userEmailConstraint) {
+			return models.ErrEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		query, args = table.EmailChange.
+			DELETE().
+			WHERE(table.EmailChange.UserID.EQ(postgres.Int(int64(change.UserID)))).
+			Sql()
+
+		_, err = tx.Exec(ctx, query, args...)
+
+		return err
+	})
+	if err != nil {
+		return models.EmailChange{}, err
+	}
+
+	return change, nil
+}
@@ -8,15 +8,16 @@ import (
 
 func toDomain(user model.User, followingIDs []int32, followerIDs []int32) models.User {
 	return models.User{
-		ID:           user.ID,
-		Name:         user.Name,
-		PasswordHash: user.PasswordHash,
-		Username:     user.Username,
-		Email:        user.Email,
-		Bio:          lo.FromPtr(user.Bio),
-		ProfileImage: lo.FromPtr(user.ProfileImage),
-		CoverImage:   lo.FromPtr(user.CoverImage),
-		FollowingIDs: followingIDs,
-		FollowerIDs:  followerIDs,
+		ID:                user.ID,
+		Name:              user.Name,
+		PasswordHash:      user.PasswordHash,
+		Username:          user.Username,
+		Email:             user.Email,
+		Bio:               lo.FromPtr(user.Bio),
+		ProfileImage:      lo.FromPtr(user.ProfileImage),
+		CoverImage:        lo.FromPtr(user.CoverImage),
+		FollowingIDs:      followingIDs,
+		FollowerIDs:       followerIDs,
+		PasswordChangedAt: lo.FromPtr(user.PasswordChangedAt),
 	}
 }
@@ -0,0 +1,62 @@
+package user
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/table"
+)
+
+// KnownFollowers joins the follows of the viewer with the followers of the
+// target. Both sides are lookups on the primary key of follow, so the cost
+// grows with the number of users the viewer follows, not with the size of
+// the graph. The window count gives the total alongside the limited rows.
+func (r *Repository) KnownFollowers(ctx context.Context, viewerID, targetID int32, limit int) ([]int32, int, error) {
+	ctx = database.WithQueryName(ctx, "user.KnownFollowers")
+
+	viewerFollows := table.Follow.AS("viewer_follows")
+	targetFollowers := table.Follow.AS("target_followers")
+
+	query, args := postgres.
+		SELECT(
+			targetFollowers.UserID,
+			postgres.COUNT(postgres.STAR).OVER().AS("total"),
+		).
+		FROM(viewerFollows.INNER_JOIN(targetFollowers,
+			targetFollowers.UserID.EQ(viewerFollows.FollowingUserID).
+				AND(targetFollowers.FollowingUserID.EQ(postgres.Int(int64(targetID)))),
+		)).
+		WHERE(viewerFollows.UserID.EQ(postgres.Int(int64(viewerID)))).
+		ORDER_BY(targetFollowers.CreatedAt.DESC(), targetFollowers.UserID.ASC()).
+		LIMIT(int64(limit)).
+		Sql()
+
+	rows, err := r.conn.ReadQuery(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var (
+		ids   []int32
+		total int64
+	)
+
+	for rows.Next() {
+		var id int32
+
+		err = rows.Scan(&id, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if rows.Err() != nil {
+		return nil, 0, rows.Err()
+	}
+
+	return ids, int(total), nil
+}
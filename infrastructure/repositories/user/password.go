@@ -0,0 +1,147 @@
+package user
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/model"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/table"
+	"time"
+)
+
+// PasswordHashes returns the current password hash of the user followed by
+// up to limit-1 previous hashes, newest first. It returns nothing when the
+// user does not exist.
+func (r *Repository) PasswordHashes(ctx context.Context, userID int32, limit int) ([]string, error) {
+	ctx = database.WithQueryName(ctx, "user.PasswordHashes")
+
+	query, args := table.User.
+		SELECT(table.User.PasswordHash).
+		WHERE(table.User.ID.EQ(postgres.Int(int64(userID)))).
+		Sql()
+
+	var current string
+
+	err := r.conn.QueryRow(ctx, query, args...).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := []string{current}
+	if limit <= 1 {
+		return hashes, nil
+	}
+
+	query, args = table.PasswordHistory.
+		SELECT(table.PasswordHistory.PasswordHash).
+		WHERE(table.PasswordHistory.UserID.EQ(postgres.Int(int64(userID)))).
+		ORDER_BY(table.PasswordHistory.CreatedAt.DESC(), table.PasswordHistory.ID.DESC()).
+		LIMIT(int64(limit - 1)).
+		Sql()
+
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	return append(hashes, previous...), nil
+}
+
+// ChangePassword replaces currentHash with newHash, moves currentHash into
+// the password history and keeps at most historySize-1 history entries.
+// It fails with models.ErrPasswordChanged when the stored hash no longer
+// matches currentHash.
+func (r *Repository) ChangePassword(
+	ctx context.Context,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	changedAt time.Time,
+) error {
+	ctx = database.WithQueryName(ctx, "user.ChangePassword")
+
+	return r.conn.InTx(ctx, func(tx *database.Tx) error {
+		return changePassword(ctx, tx, userID, currentHash, newHash, historySize, changedAt)
+	})
+}
+
+func changePassword(
+	ctx context.Context,
+	tx *database.Tx,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	changedAt time.Time,
+) error {
+	query, args := table.User.
+		UPDATE(table.User.PasswordHash, table.User.PasswordChangedAt, table.User.UpdatedAt).
+		MODEL(model.User{
+			PasswordHash:      newHash,
+			PasswordChangedAt: &changedAt,
+			UpdatedAt:         changedAt,
+		}).
+		WHERE(
+			table.User.ID.EQ(postgres.Int(int64(userID))).
+				AND(table.User.PasswordHash.EQ(postgres.String(currentHash))),
+		).
+		Sql()
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return models.ErrPasswordChanged
+	}
+
+	return appendPasswordHistory(ctx, tx, userID, currentHash, historySize)
+}
+
+func appendPasswordHistory(ctx context.Context, tx *database.Tx, userID int32, hash string, historySize int) error {
+	if historySize <= 1 {
+		return nil
+	}
+
+	query, args := table.PasswordHistory.
+		INSERT(table.PasswordHistory.UserID, table.PasswordHistory.PasswordHash).
+		MODEL(model.PasswordHistory{
+			UserID:       userID,
+			PasswordHash: hash,
+		}).
+		Sql()
+
+	_, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	keep := table.PasswordHistory.
+		SELECT(table.PasswordHistory.ID).
+		WHERE(table.PasswordHistory.UserID.EQ(postgres.Int(int64(userID)))).
+		ORDER_BY(table.PasswordHistory.CreatedAt.DESC(), table.PasswordHistory.ID.DESC()).
+		LIMIT(int64(historySize - 1))
+
+	query, args = table.PasswordHistory.
+		DELETE().
+		WHERE(
+			table.PasswordHistory.UserID.EQ(postgres.Int(int64(userID))).
+				AND(table.PasswordHistory.ID.NOT_IN(keep)),
+		).
+		Sql()
+
+	_, err = tx.Exec(ctx, query, args...)
+
+	return err
+}
@@ -0,0 +1,142 @@
+package user
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/model"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/table"
+	"time"
+)
+
+func (r *Repository) SavePasswordResetToken(ctx context.Context, userID int32, tokenHash string, expiresAt time.Time) error {
+	ctx = database.WithQueryName(ctx, "user.SavePasswordResetToken")
+
+	query, args := table.PasswordResetToken.
+		INSERT(
+			table.PasswordResetToken.TokenHash,
+			table.PasswordResetToken.UserID,
+			table.PasswordResetToken.ExpiresAt,
+		).
+		MODEL(model.PasswordResetToken{
+			TokenHash: tokenHash,
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+		}).
+		Sql()
+
+	_, err := r.conn.Exec(ctx, query, args...)
+
+	return err
+}
+
+// PasswordResetUserID returns the owner of an unused and unexpired token.
+func (r *Repository) PasswordResetUserID(ctx context.Context, tokenHash string, now time.Time) (int32, error) {
+	ctx = database.WithQueryName(ctx, "user.PasswordResetUserID")
+
+	query, args := table.PasswordResetToken.
+		SELECT(table.PasswordResetToken.UserID).
+		WHERE(activeResetToken(tokenHash, now)).
+		Sql()
+
+	var userID int32
+
+	err := r.conn.QueryRow(ctx, query, args...).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, models.ErrTokenNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// ResetPassword consumes the token, revokes every other outstanding reset
+// token of the user and changes the password as ChangePassword does.
+func (r *Repository) ResetPassword(
+	ctx context.Context,
+	tokenHash string,
+	userID int32,
+	currentHash, newHash string,
+	historySize int,
+	now time.Time,
+) error {
+	ctx = database.WithQueryName(ctx, "user.ResetPassword")
+
+	return r.conn.InTx(ctx, func(tx *database.Tx) error {
+		query, args := table.PasswordResetToken.
+			UPDATE(table.PasswordResetToken.UsedAt).
+			SET(postgres.TimestampT(now)).
+			WHERE(
+				activeResetToken(tokenHash, now).
+					AND(table.PasswordResetToken.UserID.EQ(postgres.Int(int64(userID)))),
+			).
+			Sql()
+
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return models.ErrTokenNotFound
+		}
+
+		query, args = table.PasswordResetToken.
+			UPDATE(table.PasswordResetToken.UsedAt).
+			SET(postgres.TimestampT(now)).
+			WHERE(
+				table.PasswordResetToken.UserID.EQ(postgres.Int(int64(userID))).
+					AND(table.PasswordResetToken.UsedAt.IS_NULL()),
+			).
+			Sql()
+
+		_, err = tx.Exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		return changePassword(ctx, tx, userID, currentHash, newHash, historySize, now)
+	})
+}
+
+// DeleteExpiredTokens removes used or expired password reset tokens and
+// expired email changes, returning the number of deleted rows.
+func (r *Repository) DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error) {
+	ctx = database.WithQueryName(ctx, "user.DeleteExpiredTokens")
+
+	query, args := table.PasswordResetToken.
+		DELETE().
+		WHERE(
+			table.PasswordResetToken.ExpiresAt.LT_EQ(postgres.TimestampT(now)).
+				OR(table.PasswordResetToken.UsedAt.IS_NOT_NULL()),
+		).
+		Sql()
+
+	resetTag, err := r.conn.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args = table.EmailChange.
+		DELETE().
+		WHERE(table.EmailChange.ExpiresAt.LT_EQ(postgres.TimestampT(now))).
+		Sql()
+
+	emailTag, err := r.conn.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return resetTag.RowsAffected() + emailTag.RowsAffected(), nil
+}
+
+func activeResetToken(tokenHash string, now time.Time) postgres.BoolExpression {
+	return table.PasswordResetToken.TokenHash.EQ(postgres.String(tokenHash)).
+		AND(table.PasswordResetToken.UsedAt.IS_NULL()).
+		AND(table.PasswordResetToken.ExpiresAt.GT(postgres.TimestampT(now)))
+}
@@ -2,9 +2,9 @@ package user
 
 import (
 	"context"
-	"errors"
 	"github.com/go-jet/jet/v2/postgres"
 	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
 	"github.com/samber/lo"
 	"github.com/vorotilkin/twitter-users/domain/models"
 	"github.com/vorotilkin/twitter-users/pkg/database"
@@ -19,61 +19,116 @@ type Repository struct {
 }
 
 func (r *Repository) UpdateByID(ctx context.Context, userToUpdate models.UserOption) (bool, error) {
-	columns, dbUser := columnsAndModelToUpdate(userToUpdate)
+	ctx = database.WithQueryName(ctx, "user.UpdateByID")
+
+	columns, dbUser, err := columnsAndModelToUpdate(userToUpdate)
+	if err != nil {
+		return false, err
+	}
 	if len(columns) == 0 {
 		return false, models.ErrNothingToUpdate
 	}
 
-	query, args := table.User.
-		UPDATE(columns).
-		WHERE(table.User.ID.EQ(postgres.Int(int64(dbUser.ID)))).
-		MODEL(dbUser).
-		Sql()
+	if !lo.Contains(userToUpdate.Fields(), models.UserFieldUsername) {
+		query, args := table.User.
+			UPDATE(columns).
+			WHERE(table.User.ID.EQ(postgres.Int(int64(dbUser.ID)))).
+			MODEL(dbUser).
+			Sql()
+
+		tag, err := r.conn.Exec(ctx, query, args...)
+		if err != nil {
+			return false, err
+		}
+
+		return tag.RowsAffected() > 0, nil
+	}
+
+	updated := false
+
+	err = r.conn.InTx(ctx, func(tx *database.Tx) error {
+		query, args := table.User.
+			SELECT(table.User.Username).
+			WHERE(table.User.ID.EQ(postgres.Int(int64(dbUser.ID)))).
+			FOR(postgres.UPDATE()).
+			Sql()
+
+		var oldUsername string
+
+		err := tx.QueryRow(ctx, query, args...).Scan(&oldUsername)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		query, args = table.User.
+			UPDATE(columns).
+			WHERE(table.User.ID.EQ(postgres.Int(int64(dbUser.ID)))).
+			MODEL(dbUser).
+			Sql()
+
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		updated = tag.RowsAffected() > 0
+		if !updated || oldUsername == dbUser.Username {
+			return nil
+		}
 
-	tag, err := r.conn.Exec(ctx, query, args...)
+		return appendUsernameHistory(ctx, tx, dbUser.ID, oldUsername)
+	})
 	if err != nil {
 		return false, err
 	}
 
-	return tag.RowsAffected() > 0, nil
+	return updated, nil
 }
 
-func columnsAndModelToUpdate(userToUpdate models.UserOption) (postgres.ColumnList, model.User) {
+func columnsAndModelToUpdate(userToUpdate models.UserOption) (postgres.ColumnList, model.User, error) {
 	user := model.User{
 		ID: userToUpdate.ID,
 	}
 
-	columns := make(postgres.ColumnList, 0, 10)
-
-	userToUpdate.Name.ForEach(func(name string) {
-		columns = append(columns, table.User.Name)
-		user.Name = name
-	})
-
-	userToUpdate.Username.ForEach(func(username string) {
-		columns = append(columns, table.User.Username)
-		user.Username = username
-	})
+	fields := lo.Uniq(userToUpdate.Fields())
+	columns := make(postgres.ColumnList, 0, len(fields))
 
-	userToUpdate.Bio.ForEach(func(bio string) {
-		columns = append(columns, table.User.Bio)
-		user.Bio = lo.ToPtr(bio)
-	})
-
-	userToUpdate.ProfileImage.ForEach(func(profileImage string) {
-		columns = append(columns, table.User.ProfileImage)
-		user.ProfileImage = lo.ToPtr(profileImage)
-	})
+	for _, field := range fields {
+		value := userToUpdate.Value(field)
+		if value.IsAbsent() && !field.Nullable() {
+			return nil, model.User{}, errors.Wrapf(models.ErrFieldNotNullable, "field %s", field)
+		}
 
-	userToUpdate.CoverImage.ForEach(func(coverImage string) {
-		columns = append(columns, table.User.CoverImage)
-		user.CoverImage = lo.ToPtr(coverImage)
-	})
+		switch field {
+		case models.UserFieldName:
+			columns = append(columns, table.User.Name)
+			user.Name = value.OrEmpty()
+		case models.UserFieldUsername:
+			columns = append(columns, table.User.Username)
+			user.Username = value.OrEmpty()
+		case models.UserFieldBio:
+			columns = append(columns, table.User.Bio)
+			user.Bio = value.ToPointer()
+		case models.UserFieldProfileImage:
+			columns = append(columns, table.User.ProfileImage)
+			user.ProfileImage = value.ToPointer()
+		case models.UserFieldCoverImage:
+			columns = append(columns, table.User.CoverImage)
+			user.CoverImage = value.ToPointer()
+		default:
+			return nil, model.User{}, errors.Wrapf(models.ErrUnknownUserField, "field %s", field)
+		}
+	}
 
-	return columns, user
+	return columns, user, nil
 }
 
 func (r *Repository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User, error) {
+	ctx = database.WithQueryName(ctx, "user.UsersByIDs")
+
 	userIDs := lo.Map(ids, func(id int32, _ int) postgres.Expression {
 		return postgres.Int(int64(id))
 	})
@@ -100,13 +155,14 @@ func (r *Repository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User
 			table.User.Bio,
 			table.User.ProfileImage,
 			table.User.CoverImage,
+			table.User.PasswordChangedAt,
 			followingSubquery.AS("following_ids"),
 			followersSubquery.AS("followers_ids"),
 		).
 		WHERE(table.User.ID.IN(userIDs...)).
 		Sql()
 
-	rows, err := r.conn.Query(ctx, query, args...)
+	rows, err := r.conn.ReadQuery(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +186,7 @@ func (r *Repository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User
 			&user.Bio,
 			&user.ProfileImage,
 			&user.CoverImage,
+			&user.PasswordChangedAt,
 			&followingIDs,
 			&followerIDs,
 		)
@@ -142,6 +199,8 @@ func (r *Repository) UsersByIDs(ctx context.Context, ids []int32) ([]models.User
 }
 
 func (r *Repository) UserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx = database.WithQueryName(ctx, "user.UserByEmail")
+
 	query, args := table.User.
 		SELECT(
 			table.User.ID,
@@ -152,11 +211,12 @@ func (r *Repository) UserByEmail(ctx context.Context, email string) (models.User
 			table.User.Bio,
 			table.User.ProfileImage,
 			table.User.CoverImage,
+			table.User.PasswordChangedAt,
 		).
 		WHERE(table.User.Email.EQ(postgres.Text(email))).
 		Sql()
 
-	row := r.conn.QueryRow(ctx, query, args...)
+	row := r.conn.ReadQueryRow(ctx, query, args...)
 	user := model.User{}
 
 	err := row.Scan(
@@ -168,6 +228,7 @@ func (r *Repository) UserByEmail(ctx context.Context, email string) (models.User
 		&user.Bio,
 		&user.ProfileImage,
 		&user.CoverImage,
+		&user.PasswordChangedAt,
 	)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		return models.User{}, err
@@ -177,6 +238,8 @@ func (r *Repository) UserByEmail(ctx context.Context, email string) (models.User
 }
 
 func (r *Repository) Create(ctx context.Context, name, passwordHash, username, email string) (models.User, error) {
+	ctx = database.WithQueryName(ctx, "user.Create")
+
 	query, args := table.User.
 		INSERT(table.User.Name, table.User.PasswordHash, table.User.Username, table.User.Email).
 		MODEL(model.User{
@@ -204,6 +267,9 @@ func (r *Repository) Create(ctx context.Context, name, passwordHash, username, e
 		&user.Username,
 		&user.Email,
 	)
+	if database.IsUniqueViolation(err, userEmailConstraint) {
+		return models.User{}, models.ErrEmailTaken
+	}
 	if err != nil {
 		return models.User{}, err
 	}
@@ -212,6 +278,8 @@ func (r *Repository) Create(ctx context.Context, name, passwordHash, username, e
 }
 
 func (r *Repository) FetchPasswordHashByEmail(ctx context.Context, email string) (string, error) {
+	ctx = database.WithQueryName(ctx, "user.FetchPasswordHashByEmail")
+
 	query, args := table.User.
 		SELECT(table.User.PasswordHash).
 		WHERE(table.User.Email.EQ(postgres.Text(email))).
@@ -231,6 +299,8 @@ func (r *Repository) FetchPasswordHashByEmail(ctx context.Context, email string)
 }
 
 func (r *Repository) Follow(ctx context.Context, userID, targetUserID int32) (bool, error) {
+	ctx = database.WithQueryName(ctx, "user.Follow")
+
 	query, args := table.Follow.
 		INSERT(table.Follow.UserID, table.Follow.FollowingUserID).
 		MODEL(model.Follow{
@@ -248,6 +318,8 @@ func (r *Repository) Follow(ctx context.Context, userID, targetUserID int32) (bo
 }
 
 func (r *Repository) Unfollow(ctx context.Context, userID, targetUserID int32) (bool, error) {
+	ctx = database.WithQueryName(ctx, "user.Unfollow")
+
 	query, args := table.Follow.
 		DELETE().WHERE(
 		table.Follow.UserID.EQ(postgres.Int(int64(userID))).
@@ -266,6 +338,8 @@ func (r *Repository) Unfollow(ctx context.Context, userID, targetUserID int32) (
 }
 
 func (r *Repository) NewUsers(ctx context.Context, limit int32) ([]models.User, error) {
+	ctx = database.WithQueryName(ctx, "user.NewUsers")
+
 	if limit == 0 {
 		limit = defaultNewUsersLimit
 	}
@@ -292,6 +366,7 @@ func (r *Repository) NewUsers(ctx context.Context, limit int32) ([]models.User,
 			table.User.Bio,
 			table.User.ProfileImage,
 			table.User.CoverImage,
+			table.User.PasswordChangedAt,
 			followingSubquery.AS("following_ids"),
 			followersSubquery.AS("followers_ids"),
 		).
@@ -299,7 +374,7 @@ func (r *Repository) NewUsers(ctx context.Context, limit int32) ([]models.User,
 		LIMIT(int64(limit)).
 		Sql()
 
-	rows, err := r.conn.Query(ctx, query, args...)
+	rows, err := r.conn.ReadQuery(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -323,6 +398,7 @@ func (r *Repository) NewUsers(ctx context.Context, limit int32) ([]models.User,
 			&user.Bio,
 			&user.ProfileImage,
 			&user.CoverImage,
+			&user.PasswordChangedAt,
 			&followingIDs,
 			&followerIDs,
 		)
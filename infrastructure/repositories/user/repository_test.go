@@ -0,0 +1,27 @@
+package user_test
+
+import (
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/repotest"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/user"
+	"github.com/vorotilkin/twitter-users/pkg/database/dbtest"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"testing"
+)
+
+func TestUsersRepository(t *testing.T) {
+	db := dbtest.New(t)
+
+	newRepository := func(t *testing.T) *user.Repository {
+		dbtest.Truncate(t, db, "user")
+
+		return user.NewRepository(db)
+	}
+
+	repotest.UsersRepository(t, func(t *testing.T) usecases.UsersRepository {
+		return newRepository(t)
+	})
+	repotest.FollowGraphRepository(t, func(t *testing.T) (usecases.UsersRepository, usecases.FollowGraphRepository) {
+		repo := newRepository(t)
+		return repo, repo
+	})
+}
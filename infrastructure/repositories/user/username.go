@@ -0,0 +1,73 @@
+package user
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/model"
+	"github.com/vorotilkin/twitter-users/schema/gen/my_database/public/table"
+	"time"
+)
+
+// UserIDByUsername returns the id of the user currently holding username,
+// or zero when nobody holds it.
+func (r *Repository) UserIDByUsername(ctx context.Context, username string) (int32, error) {
+	ctx = database.WithQueryName(ctx, "user.UserIDByUsername")
+
+	query, args := table.User.
+		SELECT(table.User.ID).
+		WHERE(table.User.Username.EQ(postgres.String(username))).
+		ORDER_BY(table.User.ID.ASC()).
+		LIMIT(1).
+		Sql()
+
+	var userID int32
+
+	err := r.conn.QueryRow(ctx, query, args...).Scan(&userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// PreviousUsernameOwner returns the id of the user who most recently gave up
+// username no earlier than since, or zero when there is none.
+func (r *Repository) PreviousUsernameOwner(ctx context.Context, username string, since time.Time) (int32, error) {
+	ctx = database.WithQueryName(ctx, "user.PreviousUsernameOwner")
+
+	query, args := table.UsernameHistory.
+		SELECT(table.UsernameHistory.UserID).
+		WHERE(
+			table.UsernameHistory.Username.EQ(postgres.String(username)).
+				AND(table.UsernameHistory.ChangedAt.GT_EQ(postgres.TimestampT(since))),
+		).
+		ORDER_BY(table.UsernameHistory.ChangedAt.DESC(), table.UsernameHistory.ID.DESC()).
+		LIMIT(1).
+		Sql()
+
+	var userID int32
+
+	err := r.conn.QueryRow(ctx, query, args...).Scan(&userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func appendUsernameHistory(ctx context.Context, tx *database.Tx, userID int32, username string) error {
+	query, args := table.UsernameHistory.
+		INSERT(table.UsernameHistory.UserID, table.UsernameHistory.Username).
+		MODEL(model.UsernameHistory{
+			UserID:   userID,
+			Username: username,
+		}).
+		Sql()
+
+	_, err := tx.Exec(ctx, query, args...)
+
+	return err
+}
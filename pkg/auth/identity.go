@@ -0,0 +1,27 @@
+package auth
+
+import "context"
+
+// Identity is the authenticated caller of an RPC. Exactly one of UserID and
+// Service is set.
+type Identity struct {
+	UserID  int32
+	Service string
+}
+
+func (i Identity) IsService() bool {
+	return i.Service != ""
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the caller put into the context by the interceptor.
+// The second value is false for unauthenticated calls to public RPCs.
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
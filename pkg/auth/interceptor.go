@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+const bearerPrefix = "bearer "
+
+type Config struct {
+	Enabled  bool
+	JWKSFile string
+	Issuer   string
+	Audience string
+	// Services maps a service identity to the full method names it may call.
+	Services map[string][]string
+}
+
+// Authenticator verifies the bearer token of every call and enforces the
+// policy before the handler runs.
+type Authenticator struct {
+	config   Config
+	logger   *zap.Logger
+	verifier *Verifier
+	policy   Policy
+	services map[string]map[string]struct{}
+}
+
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authorizes streams before the first message is
+// read, so Owner rules never match them.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (a *Authenticator) authorize(ctx context.Context, method string, req any) (context.Context, error) {
+	if !a.config.Enabled {
+		return ctx, nil
+	}
+
+	raw, ok := bearerToken(ctx)
+	if !ok {
+		if a.policy[method].Public {
+			return ctx, nil
+		}
+
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	identity, err := a.verifier.Verify(raw)
+	if err != nil {
+		requestid.Logger(ctx, a.logger).Debug("invalid bearer token", zap.String("method", method), zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+
+	if !a.allows(identity, method, req) {
+		return nil, status.Error(codes.PermissionDenied, "caller is not allowed to call this method")
+	}
+
+	return WithIdentity(ctx, identity), nil
+}
+
+func (a *Authenticator) allows(identity Identity, method string, req any) bool {
+	if identity.IsService() {
+		_, ok := a.services[identity.Service][method]
+		return ok || a.policy[method].Public
+	}
+
+	return a.policy.allowsUser(method, identity.UserID, req)
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+
+	if len(values[0]) <= len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	return values[0][len(bearerPrefix):], true
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// NewAuthenticator merges the policies of every registered service. The JWKS
+// file is only read when authentication is enabled.
+func NewAuthenticator(c Config, log *zap.Logger, policies ...Policy) (*Authenticator, error) {
+	a := &Authenticator{
+		config:   c,
+		logger:   log,
+		policy:   make(Policy),
+		services: make(map[string]map[string]struct{}, len(c.Services)),
+	}
+
+	for _, policy := range policies {
+		for method, rule := range policy {
+			a.policy[method] = rule
+		}
+	}
+
+	for service, methods := range c.Services {
+		a.services[service] = make(map[string]struct{}, len(methods))
+		for _, method := range methods {
+			a.services[service][method] = struct{}{}
+		}
+	}
+
+	if !c.Enabled {
+		log.Warn("authentication is disabled, every caller may call every method")
+		return a, nil
+	}
+
+	verifier, err := NewVerifier(c)
+	if err != nil {
+		return nil, err
+	}
+
+	a.verifier = verifier
+
+	return a, nil
+}
+
+func (c Config) Validate() error {
+	if c.Enabled && c.JWKSFile == "" {
+		return errors.New("jwksFile is required when auth is enabled")
+	}
+
+	return nil
+}
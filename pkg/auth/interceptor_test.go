@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	publicMethod   = "/users.Users/Create"
+	anyUserMethod  = "/users.Users/KnownFollowers"
+	ownerMethod    = "/users.Users/UpdateByID"
+	serviceMethod  = "/users.Users/PasswordHashByEmail"
+	unlistedMethod = "/users.Users/Unlisted"
+)
+
+type updateRequest struct{ id int32 }
+
+var testPolicy = Policy{
+	publicMethod:  {Public: true},
+	anyUserMethod: {AnyUser: true},
+	ownerMethod:   {Owner: func(req any) int32 { return req.(updateRequest).id }},
+}
+
+func newTestAuthenticator(t *testing.T, key signingKey) *Authenticator {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, key)
+
+	a, err := NewAuthenticator(Config{
+		Enabled:  true,
+		JWKSFile: path,
+		Issuer:   issuer,
+		Audience: audience,
+		Services: map[string][]string{"auth": {serviceMethod}},
+	}, zap.NewNop(), testPolicy)
+	require.NoError(t, err)
+
+	return a
+}
+
+func withToken(token string) context.Context {
+	if token == "" {
+		return context.Background()
+	}
+
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthorize(t *testing.T) {
+	key := newSigningKey(t, "current")
+	a := newTestAuthenticator(t, key)
+
+	user := key.sign(t, userClaims("7"))
+	serviceClaims := userClaims("auth")
+	serviceClaims.Service = "auth"
+	service := key.sign(t, serviceClaims)
+	forged := newSigningKey(t, "current").sign(t, userClaims("7"))
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		token  string
+		req    any
+		want   codes.Code
+		caller *Identity
+	}{
+		{name: "public without a token", method: publicMethod, want: codes.OK},
+		{name: "public with an invalid token", method: publicMethod, token: forged, want: codes.Unauthenticated},
+		{name: "public with a user", method: publicMethod, token: user, want: codes.OK, caller: &Identity{UserID: 7}},
+		{name: "protected without a token", method: anyUserMethod, want: codes.Unauthenticated},
+		{name: "protected with an invalid token", method: anyUserMethod, token: "garbage", want: codes.Unauthenticated},
+		{name: "any user", method: anyUserMethod, token: user, want: codes.OK, caller: &Identity{UserID: 7}},
+		{name: "owner", method: ownerMethod, token: user, req: updateRequest{id: 7}, want: codes.OK, caller: &Identity{UserID: 7}},
+		{name: "not the owner", method: ownerMethod, token: user, req: updateRequest{id: 8}, want: codes.PermissionDenied},
+		{name: "missing from the policy", method: unlistedMethod, token: user, want: codes.PermissionDenied},
+		{name: "missing from the policy without a token", method: unlistedMethod, want: codes.Unauthenticated},
+		{name: "allow-listed service", method: serviceMethod, token: service, want: codes.OK, caller: &Identity{Service: "auth"}},
+		{name: "service off its allow-list", method: ownerMethod, token: service, req: updateRequest{id: 7}, want: codes.PermissionDenied},
+		{name: "service on a public method", method: publicMethod, token: service, want: codes.OK, caller: &Identity{Service: "auth"}},
+		{name: "user on a service method", method: serviceMethod, token: user, want: codes.PermissionDenied},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var caller *Identity
+
+			_, err := a.UnaryServerInterceptor()(withToken(tt.token), tt.req, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(ctx context.Context, _ any) (any, error) {
+					if identity, ok := FromContext(ctx); ok {
+						caller = &identity
+					}
+
+					return nil, nil
+				})
+
+			assert.Equal(t, tt.want, status.Code(err))
+			assert.Equal(t, tt.caller, caller)
+		})
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s testStream) Context() context.Context { return s.ctx }
+
+func TestAuthorizeStream(t *testing.T) {
+	key := newSigningKey(t, "current")
+	a := newTestAuthenticator(t, key)
+	user := key.sign(t, userClaims("7"))
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		token  string
+		want   codes.Code
+	}{
+		{name: "any user", method: anyUserMethod, token: user, want: codes.OK},
+		{name: "without a token", method: anyUserMethod, want: codes.Unauthenticated},
+		{name: "owner rules see no request", method: ownerMethod, token: user, want: codes.PermissionDenied},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.StreamServerInterceptor()(nil, testStream{ctx: withToken(tt.token)}, &grpc.StreamServerInfo{FullMethod: tt.method},
+				func(_ any, ss grpc.ServerStream) error {
+					identity, ok := FromContext(ss.Context())
+					assert.True(t, ok)
+					assert.Equal(t, Identity{UserID: 7}, identity)
+
+					return nil
+				})
+
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
+
+func TestDisabledAllowsEveryone(t *testing.T) {
+	a, err := NewAuthenticator(Config{}, zap.NewNop(), testPolicy)
+	require.NoError(t, err)
+
+	_, err = a.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: unlistedMethod},
+		func(context.Context, any) (any, error) { return nil, nil })
+	assert.NoError(t, err)
+}
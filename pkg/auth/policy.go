@@ -0,0 +1,30 @@
+package auth
+
+// Rule describes which users may call an RPC. Service identities are not
+// covered by rules; they are allow-listed per RPC in Config.Services.
+type Rule struct {
+	// Public RPCs may be called without credentials.
+	Public bool
+	// AnyUser lets every authenticated user call the RPC.
+	AnyUser bool
+	// Owner returns the ID of the user the request acts on; only that user
+	// may call the RPC.
+	Owner func(req any) int32
+}
+
+// Policy maps full gRPC method names to rules. Users are denied RPCs
+// without a rule.
+type Policy map[string]Rule
+
+func (p Policy) allowsUser(method string, userID int32, req any) bool {
+	rule, ok := p[method]
+	if !ok {
+		return false
+	}
+
+	if rule.Public || rule.AnyUser {
+		return true
+	}
+
+	return rule.Owner != nil && req != nil && rule.Owner(req) == userID
+}
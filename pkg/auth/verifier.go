@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"encoding/json"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/pkg/errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	leeway = 30 * time.Second
+	// keysRefreshInterval limits how often a token signed with an unknown
+	// key rereads the JWKS file, which is how rotated keys are picked up.
+	keysRefreshInterval = time.Minute
+)
+
+var signatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// claims are the registered JWT claims plus svc, which marks a token issued
+// to another service rather than to an end user.
+type claims struct {
+	jwt.Claims
+	Service string `json:"svc"`
+}
+
+// Verifier checks JWT signatures against the keys of a JWKS file. The file
+// is read again when a token names a key it does not hold.
+type Verifier struct {
+	path         string
+	issuer       string
+	audience     string
+	refreshAfter time.Duration
+
+	mu       sync.Mutex
+	keys     jose.JSONWebKeySet
+	loadedAt time.Time
+}
+
+// Verify validates the token and returns the caller it was issued to. User
+// tokens carry the numeric user ID in sub.
+func (v *Verifier) Verify(raw string) (Identity, error) {
+	token, err := jwt.ParseSigned(raw, signatureAlgorithms)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "parse token")
+	}
+
+	key, err := v.key(token.Headers[0].KeyID)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var c claims
+	err = token.Claims(key, &c)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "verify signature")
+	}
+
+	if c.Expiry == nil {
+		return Identity{}, errors.New("token has no expiry")
+	}
+
+	expected := jwt.Expected{Issuer: v.issuer, Time: time.Now()}
+	if v.audience != "" {
+		expected.AnyAudience = jwt.Audience{v.audience}
+	}
+
+	err = c.ValidateWithLeeway(expected, leeway)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "validate claims")
+	}
+
+	if c.Service != "" {
+		return Identity{Service: c.Service}, nil
+	}
+
+	userID, err := strconv.ParseInt(c.Subject, 10, 32)
+	if err != nil || userID <= 0 {
+		return Identity{}, errors.Errorf("invalid subject %q", c.Subject)
+	}
+
+	return Identity{UserID: int32(userID)}, nil
+}
+
+func (v *Verifier) key(kid string) (jose.JSONWebKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if kid == "" {
+		if len(v.keys.Keys) == 1 {
+			return v.keys.Keys[0], nil
+		}
+
+		return jose.JSONWebKey{}, errors.New("token has no key id")
+	}
+
+	keys := v.keys.Key(kid)
+	if len(keys) == 0 && time.Since(v.loadedAt) >= v.refreshAfter {
+		// A failed reload keeps the keys already loaded.
+		loaded, err := loadKeys(v.path)
+		if err != nil {
+			return jose.JSONWebKey{}, errors.Wrapf(err, "unknown key id %q", kid)
+		}
+
+		v.keys, v.loadedAt = loaded, time.Now()
+		keys = v.keys.Key(kid)
+	}
+
+	if len(keys) == 0 {
+		return jose.JSONWebKey{}, errors.Errorf("unknown key id %q", kid)
+	}
+
+	return keys[0], nil
+}
+
+func loadKeys(path string) (jose.JSONWebKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrap(err, "read jwks file")
+	}
+
+	var keys jose.JSONWebKeySet
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrap(err, "parse jwks file")
+	}
+
+	if len(keys.Keys) == 0 {
+		return jose.JSONWebKeySet{}, errors.New("jwks file has no keys")
+	}
+
+	for _, key := range keys.Keys {
+		if !key.IsPublic() {
+			return jose.JSONWebKeySet{}, errors.Errorf("jwks key %q is not a public key", key.KeyID)
+		}
+	}
+
+	return keys, nil
+}
+
+func NewVerifier(c Config) (*Verifier, error) {
+	keys, err := loadKeys(c.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{
+		path:         c.JWKSFile,
+		issuer:       c.Issuer,
+		audience:     c.Audience,
+		refreshAfter: keysRefreshInterval,
+		keys:         keys,
+		loadedAt:     time.Now(),
+	}, nil
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	issuer   = "twitter-auth"
+	audience = "twitter-users"
+)
+
+type signingKey struct {
+	kid     string
+	private *ecdsa.PrivateKey
+}
+
+func newSigningKey(t *testing.T, kid string) signingKey {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return signingKey{kid: kid, private: private}
+}
+
+// writeJWKS writes the public halves of keys to a JWKS file at path.
+func writeJWKS(t *testing.T, path string, keys ...signingKey) {
+	t.Helper()
+
+	var set jose.JSONWebKeySet
+	for _, key := range keys {
+		set.Keys = append(set.Keys, jose.JSONWebKey{Key: &key.private.PublicKey, KeyID: key.kid, Algorithm: string(jose.ES256), Use: "sig"})
+	}
+
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func (k signingKey) sign(t *testing.T, c claims) string {
+	t.Helper()
+
+	options := (&jose.SignerOptions{}).WithType("JWT")
+	if k.kid != "" {
+		options = options.WithHeader(jose.HeaderKey("kid"), k.kid)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: k.private}, options)
+	require.NoError(t, err)
+
+	token, err := jwt.Signed(signer).Claims(c).Serialize()
+	require.NoError(t, err)
+
+	return token
+}
+
+// userClaims are valid claims for subject, changed by each test.
+func userClaims(subject string) claims {
+	return claims{Claims: jwt.Claims{
+		Issuer:   issuer,
+		Audience: jwt.Audience{audience},
+		Subject:  subject,
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+}
+
+func newTestVerifier(t *testing.T, keys ...signingKey) (*Verifier, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, keys...)
+
+	v, err := NewVerifier(Config{JWKSFile: path, Issuer: issuer, Audience: audience})
+	require.NoError(t, err)
+
+	return v, path
+}
+
+func TestVerify(t *testing.T) {
+	key := newSigningKey(t, "current")
+	v, _ := newTestVerifier(t, key)
+
+	for _, tt := range []struct {
+		name    string
+		token   func() string
+		want    Identity
+		wantErr bool
+	}{
+		{
+			name:  "user",
+			token: func() string { return key.sign(t, userClaims("42")) },
+			want:  Identity{UserID: 42},
+		},
+		{
+			name: "service",
+			token: func() string {
+				c := userClaims("mailer")
+				c.Service = "mailer"
+				return key.sign(t, c)
+			},
+			want: Identity{Service: "mailer"},
+		},
+		{
+			name: "single key without a key id",
+			token: func() string {
+				return signingKey{private: key.private}.sign(t, userClaims("42"))
+			},
+			want: Identity{UserID: 42},
+		},
+		{
+			name: "expired",
+			token: func() string {
+				c := userClaims("42")
+				c.Expiry = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				return key.sign(t, c)
+			},
+			wantErr: true,
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				c := userClaims("42")
+				c.Expiry = nil
+				return key.sign(t, c)
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				c := userClaims("42")
+				c.Issuer = "someone-else"
+				return key.sign(t, c)
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				c := userClaims("42")
+				c.Audience = jwt.Audience{"twitter-tweets"}
+				return key.sign(t, c)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown key id",
+			token:   func() string { return newSigningKey(t, "other").sign(t, userClaims("42")) },
+			wantErr: true,
+		},
+		{
+			name:    "forged signature",
+			token:   func() string { return newSigningKey(t, "current").sign(t, userClaims("42")) },
+			wantErr: true,
+		},
+		{
+			name:    "invalid subject",
+			token:   func() string { return key.sign(t, userClaims("alice")) },
+			wantErr: true,
+		},
+		{
+			name:    "not a token",
+			token:   func() string { return "not.a.token" },
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := v.Verify(tt.token())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, identity)
+		})
+	}
+}
+
+func TestVerifierRefreshesKeys(t *testing.T) {
+	current := newSigningKey(t, "current")
+	rotated := newSigningKey(t, "rotated")
+	v, path := newTestVerifier(t, current)
+
+	writeJWKS(t, path, current, rotated)
+
+	_, err := v.Verify(rotated.sign(t, userClaims("42")))
+	assert.Error(t, err, "the file is not reread more than once per interval")
+
+	v.refreshAfter = 0
+
+	identity, err := v.Verify(rotated.sign(t, userClaims("42")))
+	require.NoError(t, err, "a rotated key is picked up")
+	assert.Equal(t, Identity{UserID: 42}, identity)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+	_, err = v.Verify(newSigningKey(t, "unknown").sign(t, userClaims("42")))
+	assert.Error(t, err)
+
+	_, err = v.Verify(current.sign(t, userClaims("42")))
+	assert.NoError(t, err, "a broken file keeps the keys already loaded")
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	DriverNone   = "none"
+	DriverMemory = "memory"
+	DriverRedis  = "redis"
+
+	defaultSize = 10000
+	defaultTTL  = 5 * time.Minute
+)
+
+type Config struct {
+	Driver string
+	Size   int
+	TTL    time.Duration
+	Redis  RedisConfig
+}
+
+type RedisConfig struct {
+	Address  string
+	Password string
+	DB       int
+}
+
+// Cache is a byte-oriented key value cache. Missing keys are simply absent
+// from GetMany results.
+type Cache interface {
+	GetMany(ctx context.Context, keys []string) (map[string][]byte, error)
+	SetMany(ctx context.Context, items map[string][]byte) error
+	Delete(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+func New(c Config) (Cache, error) {
+	if c.Size <= 0 {
+		c.Size = defaultSize
+	}
+
+	if c.TTL <= 0 {
+		c.TTL = defaultTTL
+	}
+
+	switch c.Driver {
+	case DriverMemory:
+		return NewMemory(c.Size, c.TTL), nil
+	case DriverRedis:
+		return NewRedis(c.Redis, c.TTL), nil
+	case DriverNone, "":
+		return Noop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", c.Driver)
+	}
+}
+
+// Noop never stores anything.
+type Noop struct{}
+
+func (Noop) GetMany(context.Context, []string) (map[string][]byte, error) { return nil, nil }
+func (Noop) SetMany(context.Context, map[string][]byte) error             { return nil }
+func (Noop) Delete(context.Context, ...string) error                      { return nil }
+func (Noop) Close() error                                                 { return nil }
+
+func (c Config) Validate() error {
+	switch c.Driver {
+	case DriverNone, DriverMemory, "":
+		return nil
+	case DriverRedis:
+		if c.Redis.Address == "" {
+			return errors.New("redis.address is required for the redis driver")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown driver %q", c.Driver)
+	}
+}
@@ -0,0 +1,152 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	testCache(t, func(t *testing.T) cache.Cache {
+		return cache.NewMemory(10, time.Minute)
+	})
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		ctx := context.Background()
+		c := cache.NewMemory(2, time.Minute)
+
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("2")}))
+
+		_, err := c.GetMany(ctx, []string{"a"})
+		require.NoError(t, err)
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"c": []byte("3")}))
+
+		items, err := c.GetMany(ctx, []string{"a", "b", "c"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a": []byte("1"), "c": []byte("3")}, items)
+	})
+
+	t.Run("expires after the ttl", func(t *testing.T) {
+		ctx := context.Background()
+		c := cache.NewMemory(10, 10*time.Millisecond)
+
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1")}))
+
+		assert.Eventually(t, func() bool {
+			items, err := c.GetMany(ctx, []string{"a"})
+			return err == nil && len(items) == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestRedis(t *testing.T) {
+	newRedis := func(t *testing.T) (*miniredis.Miniredis, *cache.Redis) {
+		server := miniredis.RunT(t)
+
+		c := cache.NewRedis(cache.RedisConfig{Address: server.Addr()}, time.Minute)
+		t.Cleanup(func() { _ = c.Close() })
+
+		return server, c
+	}
+
+	testCache(t, func(t *testing.T) cache.Cache {
+		_, c := newRedis(t)
+		return c
+	})
+
+	t.Run("expires after the ttl", func(t *testing.T) {
+		ctx := context.Background()
+		server, c := newRedis(t)
+
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1")}))
+		assert.Equal(t, time.Minute, server.TTL("a"))
+
+		server.FastForward(time.Minute)
+
+		items, err := c.GetMany(ctx, []string{"a"})
+		require.NoError(t, err)
+		assert.Empty(t, items)
+	})
+
+	t.Run("reports an unreachable server", func(t *testing.T) {
+		server, c := newRedis(t)
+		server.Close()
+
+		_, err := c.GetMany(context.Background(), []string{"a"})
+		assert.Error(t, err)
+	})
+}
+
+// testCache checks the behaviour every driver shares.
+func testCache(t *testing.T, newCache func(t *testing.T) cache.Cache) {
+	ctx := context.Background()
+
+	t.Run("gets what was set", func(t *testing.T) {
+		c := newCache(t)
+
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("2")}))
+
+		items, err := c.GetMany(ctx, []string{"a", "b", "missing"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, items)
+	})
+
+	t.Run("set overwrites", func(t *testing.T) {
+		c := newCache(t)
+
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1")}))
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("2")}))
+
+		items, err := c.GetMany(ctx, []string{"a"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a": []byte("2")}, items)
+	})
+
+	t.Run("delete drops the keys", func(t *testing.T) {
+		c := newCache(t)
+
+		require.NoError(t, c.SetMany(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("2")}))
+		require.NoError(t, c.Delete(ctx, "a", "missing"))
+
+		items, err := c.GetMany(ctx, []string{"a", "b"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"b": []byte("2")}, items)
+	})
+
+	t.Run("empty arguments", func(t *testing.T) {
+		c := newCache(t)
+
+		items, err := c.GetMany(ctx, nil)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+		assert.NoError(t, c.SetMany(ctx, nil))
+		assert.NoError(t, c.Delete(ctx))
+	})
+}
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		driver string
+		want   cache.Cache
+	}{
+		{driver: "", want: cache.Noop{}},
+		{driver: cache.DriverNone, want: cache.Noop{}},
+		{driver: cache.DriverMemory, want: &cache.Memory{}},
+		{driver: cache.DriverRedis, want: &cache.Redis{}},
+	} {
+		t.Run(tt.driver, func(t *testing.T) {
+			c, err := cache.New(cache.Config{Driver: tt.driver})
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = c.Close() })
+
+			assert.IsType(t, tt.want, c)
+		})
+	}
+
+	_, err := cache.New(cache.Config{Driver: "memcached"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"time"
+)
+
+// Memory is an in-process LRU cache whose entries expire after a TTL.
+type Memory struct {
+	lru *expirable.LRU[string, []byte]
+}
+
+func (m *Memory) GetMany(_ context.Context, keys []string) (map[string][]byte, error) {
+	items := make(map[string][]byte, len(keys))
+
+	for _, key := range keys {
+		value, ok := m.lru.Get(key)
+		if ok {
+			items[key] = value
+		}
+	}
+
+	return items, nil
+}
+
+func (m *Memory) SetMany(_ context.Context, items map[string][]byte) error {
+	for key, value := range items {
+		m.lru.Add(key, value)
+	}
+
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		m.lru.Remove(key)
+	}
+
+	return nil
+}
+
+func (m *Memory) Close() error {
+	m.lru.Purge()
+
+	return nil
+}
+
+func NewMemory(size int, ttl time.Duration) *Memory {
+	return &Memory{lru: expirable.NewLRU[string, []byte](size, nil, ttl)}
+}
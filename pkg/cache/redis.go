@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// Redis talks the Redis protocol, so it works with Redis itself and with
+// compatible servers such as a local stand-in in tests.
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func (r *Redis) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[string][]byte, len(keys))
+
+	for i, value := range values {
+		s, ok := value.(string)
+		if ok {
+			items[keys[i]] = []byte(s)
+		}
+	}
+
+	return items, nil
+}
+
+func (r *Redis) SetMany(ctx context.Context, items map[string][]byte) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range items {
+			pipe.Set(ctx, key, value, r.ttl)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+func NewRedis(c RedisConfig, ttl time.Duration) *Redis {
+	return &Redis{
+		client: redis.NewClient(&redis.Options{
+			Addr:     c.Address,
+			Password: c.Password,
+			DB:       c.DB,
+		}),
+		ttl: ttl,
+	}
+}
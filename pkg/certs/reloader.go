@@ -0,0 +1,206 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const reloadDelay = 100 * time.Millisecond
+
+// Reloader keeps a certificate, its key and an optional CA bundle in memory
+// and reloads them whenever the files change on disk. A failed reload keeps
+// the previous material, so a half-written file never breaks handshakes.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	logger   *zap.Logger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	cas  *x509.CertPool
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// Certificate returns the current certificate. It fits tls.Config.GetCertificate.
+func (r *Reloader) Certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// ClientCertificate returns the current certificate. It fits
+// tls.Config.GetClientCertificate.
+func (r *Reloader) ClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, _ := r.Certificate(nil)
+	if cert == nil {
+		// An empty certificate tells crypto/tls to continue without one.
+		return &tls.Certificate{}, nil
+	}
+
+	return cert, nil
+}
+
+// CAs returns the current CA bundle, or nil when no CA file is configured.
+func (r *Reloader) CAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cas
+}
+
+// Watch reloads the files on every change in their directories. Watching
+// directories instead of files survives atomic renames and the symlink swaps
+// Kubernetes uses for mounted secrets.
+func (r *Reloader) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "create watcher")
+	}
+
+	dirs := make(map[string]struct{})
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = struct{}{}
+		}
+	}
+
+	for dir := range dirs {
+		err = watcher.Add(dir)
+		if err != nil {
+			_ = watcher.Close()
+			return errors.Wrapf(err, "watch %s", dir)
+		}
+	}
+
+	r.watcher = watcher
+	r.done = make(chan struct{})
+
+	go r.loop()
+
+	return nil
+}
+
+func (r *Reloader) Close() error {
+	if r.watcher == nil {
+		return nil
+	}
+
+	err := r.watcher.Close()
+	<-r.done
+
+	return err
+}
+
+func (r *Reloader) loop() {
+	defer close(r.done)
+
+	// Writing a certificate and its key produces a burst of events; reload
+	// once the burst settles so the pair is consistent.
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if r.watches(event.Name) {
+				timer.Reset(reloadDelay)
+			}
+		case <-timer.C:
+			err := r.load()
+			if err != nil {
+				r.logger.Warn("failed to reload certificates", zap.Error(err))
+				continue
+			}
+
+			r.logger.Info("certificates reloaded", zap.String("cert", r.certFile))
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			r.logger.Warn("certificate watcher failed", zap.Error(err))
+		}
+	}
+}
+
+// watches reports whether a change to name may affect the loaded files.
+// Kubernetes updates mounted secrets by swapping the ..data symlink.
+func (r *Reloader) watches(name string) bool {
+	name = filepath.Clean(name)
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file != "" && name == filepath.Clean(file) {
+			return true
+		}
+	}
+
+	return strings.HasPrefix(filepath.Base(name), "..")
+}
+
+func (r *Reloader) load() error {
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.Wrap(err, "load key pair")
+		}
+
+		cert = &pair
+	}
+
+	var cas *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrap(err, "read ca file")
+		}
+
+		cas = x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(pem) {
+			return errors.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = cert
+	r.cas = cas
+
+	return nil
+}
+
+// NewReloader loads the files once; call Watch to follow later changes.
+// certFile and keyFile may be empty for a client without a certificate,
+// caFile for a server that does not verify clients.
+func NewReloader(certFile, keyFile, caFile string, log *zap.Logger) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		logger:   log,
+	}
+
+	err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
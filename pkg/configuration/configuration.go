@@ -1,40 +1,149 @@
 package configuration
 
 import (
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
+	"io/fs"
+	"os"
+	"reflect"
 	"strings"
+	"time"
 )
 
+// PathEnv names the config file when no --config flag is given.
+const PathEnv = "CONFIG_PATH"
+
+const (
+	defaultPath  = "config.yaml"
+	secretSuffix = "_FILE"
+)
+
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// Configuration layers, from lowest to highest priority, the defaults held
+// by the destination struct, the YAML file, environment variables named after
+// the key path (DB_PASSWORD for db.password) and files named by a _FILE
+// variable (DB_PASSWORD_FILE), meant for mounted secrets.
 type Configuration struct {
 	config            *viper.Viper
+	path              string
+	required          bool
 	decoderConfigOpts []viper.DecoderConfigOption
 }
 
+// Unmarshal fills dst, a pointer to a struct whose current values are the
+// defaults. Keys that match no field are rejected, so typos fail startup
+// instead of being ignored.
 func (c *Configuration) Unmarshal(dst any) error {
-	err := c.config.ReadInConfig()
+	registerDefaults(c.config, "", reflect.ValueOf(dst).Elem())
+
+	err := c.read()
 	if err != nil {
 		return err
 	}
 
-	err = c.config.Unmarshal(dst, c.decoderConfigOpts...)
+	err = c.readSecrets()
 	if err != nil {
 		return err
 	}
 
+	err = c.config.UnmarshalExact(dst, c.decoderConfigOpts...)
+	if err != nil {
+		return fmt.Errorf("decode config %s: %w", c.path, err)
+	}
+
+	return nil
+}
+
+// Watch calls onChange after the config file changes on disk. Nothing is
+// watched when there is no file.
+func (c *Configuration) Watch(onChange func()) {
+	if _, err := os.Stat(c.path); err != nil {
+		return
+	}
+
+	c.config.OnConfigChange(func(fsnotify.Event) { onChange() })
+	c.config.WatchConfig()
+}
+
+// Path returns the config file in use, which may not exist when no path was
+// given explicitly.
+func (c *Configuration) Path() string {
+	return c.path
+}
+
+func (c *Configuration) read() error {
+	err := c.config.ReadInConfig()
+	if err == nil {
+		return nil
+	}
+
+	if !c.required && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return fmt.Errorf("read config %s: %w", c.path, err)
+}
+
+func (c *Configuration) readSecrets() error {
+	for _, key := range c.config.AllKeys() {
+		env := strings.ToUpper(envReplacer.Replace(key)) + secretSuffix
+
+		path := os.Getenv(env)
+		if path == "" {
+			continue
+		}
+
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", env, err)
+		}
+
+		c.config.Set(key, strings.TrimRight(string(secret), "\r\n"))
+	}
+
 	return nil
 }
 
-func New() *Configuration {
+// registerDefaults turns every leaf field of v into a viper default, which
+// also makes viper look the key up in the environment.
+func registerDefaults(config *viper.Viper, prefix string, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key := prefix + strings.ToLower(field.Name)
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Struct && value.Type() != reflect.TypeOf(time.Time{}) {
+			registerDefaults(config, key+".", value)
+			continue
+		}
+
+		config.SetDefault(key, value.Interface())
+	}
+}
+
+// New reads the file at path, which must exist. An empty path falls back to
+// config.yaml in the working directory, which may be missing.
+func New(path string) *Configuration {
+	required := path != ""
+	if !required {
+		path = defaultPath
+	}
+
 	v := viper.NewWithOptions(
-		viper.KeyDelimiter("_"),
-		viper.EnvKeyReplacer(strings.NewReplacer("-", "_")),
+		viper.EnvKeyReplacer(envReplacer),
 	)
 
 	v.AutomaticEnv()
-	v.SetConfigName("config")
+	v.SetConfigFile(path)
 	v.SetConfigType("yaml")
-	v.AddConfigPath(".")
 
 	decoderConfigOpts := []viper.DecoderConfigOption{
 		func(config *mapstructure.DecoderConfig) {
@@ -47,6 +156,8 @@ func New() *Configuration {
 
 	return &Configuration{
 		config:            v,
+		path:              path,
+		required:          required,
 		decoderConfigOpts: decoderConfigOpts,
 	}
 }
@@ -0,0 +1,184 @@
+package configuration_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/pkg/configuration"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type dbConfig struct {
+	Host     string
+	Password string
+	MaxConns int
+	Timeout  time.Duration
+}
+
+type testConfig struct {
+	Log struct {
+		Level string
+	}
+	DB dbConfig
+}
+
+func defaults() *testConfig {
+	c := &testConfig{DB: dbConfig{Host: "localhost", Password: "default", MaxConns: 4, Timeout: time.Second}}
+	c.Log.Level = "info"
+
+	return c
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestUnmarshalLayers(t *testing.T) {
+	const file = `
+log:
+  level: debug
+db:
+  host: file-host
+  password: file-password
+`
+
+	for _, tt := range []struct {
+		name string
+		file string
+		env  map[string]string
+		want func(c *testConfig)
+	}{
+		{
+			name: "defaults",
+			file: "log:\n  level: info\n",
+			want: func(*testConfig) {},
+		},
+		{
+			name: "file over defaults",
+			file: file,
+			want: func(c *testConfig) {
+				c.Log.Level = "debug"
+				c.DB.Host = "file-host"
+				c.DB.Password = "file-password"
+			},
+		},
+		{
+			name: "env over file",
+			file: file,
+			env:  map[string]string{"DB_HOST": "env-host", "LOG_LEVEL": "warn"},
+			want: func(c *testConfig) {
+				c.Log.Level = "warn"
+				c.DB.Host = "env-host"
+				c.DB.Password = "file-password"
+			},
+		},
+		{
+			name: "env for keys missing from the file",
+			file: file,
+			env:  map[string]string{"DB_MAXCONNS": "16", "DB_TIMEOUT": "5s"},
+			want: func(c *testConfig) {
+				c.Log.Level = "debug"
+				c.DB.Host = "file-host"
+				c.DB.Password = "file-password"
+				c.DB.MaxConns = 16
+				c.DB.Timeout = 5 * time.Second
+			},
+		},
+		{
+			name: "camel case keys in the file",
+			file: "db:\n  maxConns: 8\n",
+			want: func(c *testConfig) { c.DB.MaxConns = 8 },
+		},
+		{
+			name: "secret file over env",
+			file: file,
+			env:  map[string]string{"DB_PASSWORD": "env-password", "DB_PASSWORD_FILE": "secret"},
+			want: func(c *testConfig) {
+				c.Log.Level = "debug"
+				c.DB.Host = "file-host"
+				c.DB.Password = "secret-password"
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				if key == "DB_PASSWORD_FILE" {
+					value = writeFile(t, value, "secret-password\n")
+				}
+
+				t.Setenv(key, value)
+			}
+
+			got := defaults()
+			require.NoError(t, configuration.New(writeFile(t, "config.yaml", tt.file)).Unmarshal(got))
+
+			want := defaults()
+			tt.want(want)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		path func(t *testing.T) string
+		env  map[string]string
+	}{
+		{
+			name: "unknown key",
+			path: func(t *testing.T) string { return writeFile(t, "config.yaml", "db:\n  hots: typo\n") },
+		},
+		{
+			name: "unknown section",
+			path: func(t *testing.T) string { return writeFile(t, "config.yaml", "cache:\n  size: 1\n") },
+		},
+		{
+			name: "explicit path missing",
+			path: func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing.yaml") },
+		},
+		{
+			name: "invalid value",
+			path: func(t *testing.T) string { return writeFile(t, "config.yaml", "db:\n  timeout: soon\n") },
+		},
+		{
+			name: "secret file missing",
+			path: func(t *testing.T) string { return writeFile(t, "config.yaml", "") },
+			env:  map[string]string{"DB_PASSWORD_FILE": "/nonexistent/password"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			assert.Error(t, configuration.New(tt.path(t)).Unmarshal(defaults()))
+		})
+	}
+}
+
+func TestMissingDefaultFile(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	t.Setenv("DB_HOST", "env-host")
+
+	c := configuration.New("")
+	assert.Equal(t, "config.yaml", c.Path())
+
+	got := defaults()
+	require.NoError(t, c.Unmarshal(got))
+
+	want := defaults()
+	want.DB.Host = "env-host"
+	assert.Equal(t, want, got, "defaults and env without a file")
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strconv"
+)
+
+func (c Config) Validate() error {
+	var errs []error
+
+	switch c.Driver {
+	case "", DriverPostgres, DriverSqlite:
+	default:
+		errs = append(errs, fmt.Errorf("unknown driver %q", c.Driver))
+	}
+
+	if c.URL != "" {
+		if _, err := pgconn.ParseConfig(c.URL); err != nil {
+			errs = append(errs, errors.New("url is not a valid connection string"))
+		}
+	} else {
+		for _, field := range []struct{ name, value string }{
+			{"host", c.Host},
+			{"port", c.Port},
+			{"user", c.User},
+			{"database", c.Database},
+		} {
+			if field.value == "" {
+				errs = append(errs, fmt.Errorf("%s is required unless url is set", field.name))
+			}
+		}
+	}
+
+	if poolSize, err := strconv.Atoi(c.PoolSize); c.PoolSize != "" && (err != nil || poolSize < 1) {
+		errs = append(errs, fmt.Errorf("poolSize must be a positive number, got %q", c.PoolSize))
+	}
+
+	switch c.SSLMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("unknown sslMode %q", c.SSLMode))
+	}
+
+	if c.MinConns < 0 {
+		errs = append(errs, errors.New("minConns must not be negative"))
+	}
+
+	if _, ok := queryExecModes[c.QueryExecMode]; c.QueryExecMode != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown queryExecMode %q", c.QueryExecMode))
+	}
+
+	if c.MaxConnLifetime < 0 || c.MaxConnIdleTime < 0 || c.HealthCheckPeriod < 0 || c.StartupTimeout < 0 {
+		errs = append(errs, errors.New("maxConnLifetime, maxConnIdleTime, healthCheckPeriod and startupTimeout must not be negative"))
+	}
+
+	if c.StatementTimeout < 0 || c.LockTimeout < 0 {
+		errs = append(errs, errors.New("statementTimeout and lockTimeout must not be negative"))
+	}
+
+	for i, replica := range c.Replicas {
+		if replica.Host == "" || replica.Port == "" {
+			errs = append(errs, fmt.Errorf("replicas[%d]: host and port are required", i))
+		}
+	}
+
+	if c.ReplicaCheckInterval < 0 || c.ReadYourWrites < 0 || c.MaxReplicaLag < 0 {
+		errs = append(errs, errors.New("replicaCheckInterval, readYourWrites and maxReplicaLag must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -4,7 +4,40 @@ import (
 	"context"
 	"fmt"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DriverPostgres = "postgres"
+	// DriverSqlite replaces Postgres with the embedded database of the
+	// sqlite package. Everything else in Config is then unused.
+	DriverSqlite = "sqlite"
+)
+
+const (
+	uniqueViolationCode = "23505"
+
+	// timeoutGrace lets context cancellation win over the server-side
+	// timeouts, so callers see a context error rather than a query error.
+	timeoutGrace = 100 * time.Millisecond
+	// cancelDeadlineDelay is how long a cancel request gets before the
+	// connection is closed.
+	cancelDeadlineDelay = time.Second
+
+	initialStartupBackoff = 250 * time.Millisecond
+	maxStartupBackoff     = 5 * time.Second
 )
 
 type Rows interface {
@@ -25,6 +58,12 @@ type CommandTag interface {
 }
 
 type Config struct {
+	// Driver is DriverPostgres, the default, or DriverSqlite.
+	Driver string
+	// URL is a full connection string, such as DATABASE_URL. When set it
+	// replaces Host, Port, User, Password, Database and SSLMode, and the
+	// pool settings and timeouts below only fill in what it leaves out.
+	URL      string
 	Host     string
 	Port     string
 	User     string
@@ -32,56 +71,564 @@ type Config struct {
 	Database string
 	PoolSize string
 	SSLMode  string
+	// MinConns connections are kept open even when idle.
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	// QueryExecMode is one of the pgx modes: cache_statement, cache_describe,
+	// describe_exec, exec or simple_protocol. Behind PgBouncer in transaction
+	// mode use exec or simple_protocol, which need no prepared statements.
+	QueryExecMode string
+	// StartupTimeout is how long New waits for the primary to answer,
+	// retrying with backoff. Zero skips the wait and connects lazily.
+	StartupTimeout time.Duration
+	// StatementTimeout and LockTimeout are session defaults for every
+	// connection. InTx shortens them to the deadline of its context in the
+	// BEGIN it sends anyway.
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+	// DeadlineTimeouts shortens them for single statements too, when the
+	// deadline comes before StatementTimeout, by running each in a
+	// transaction of its own at the cost of two more round trips, BEGIN and
+	// COMMIT. Without it a cancel request stops the statement at the
+	// deadline, and the session timeouts when that request is lost.
+	DeadlineTimeouts bool
+	// Replicas serve the reads that tolerate replication lag.
+	Replicas             []Replica
+	ReplicaCheckInterval time.Duration
+	// MaxReplicaLag takes replicas further behind the primary out of
+	// rotation. Zero disables the check.
+	MaxReplicaLag time.Duration
+	// ReadYourWrites keeps the reads of a caller on the primary for this long
+	// after it writes. Zero only pins the rest of the writing request.
+	ReadYourWrites time.Duration
+}
+
+var queryExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
 }
 
 func (c Config) PostgresDSN() string {
-	connStr := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", c.User, c.Password, c.Host, c.Port, c.Database)
-	if c.SSLMode == "disable" {
-		connStr += "?sslmode=disable"
+	if c.URL != "" {
+		return c.URL
+	}
+
+	dsn := url.URL{
+		Scheme: "postgresql",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   net.JoinHostPort(c.Host, c.Port),
+		Path:   "/" + c.Database,
 	}
 
-	return connStr
+	if c.SSLMode != "" {
+		dsn.RawQuery = url.Values{"sslmode": {c.SSLMode}}.Encode()
+	}
+
+	return dsn.String()
 }
 
 type Database struct {
+	config     Config
 	connection *pgxpool.Pool
+	replicas   []*replica
+	next       atomic.Uint32
+	// writes holds the time of the last write of every caller.
+	writes sync.Map
+
+	checking    bool
+	stopChecker chan struct{}
+	checkerDone chan struct{}
 }
 
 func (d *Database) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
-	return d.connection.Query(ctx, sql, args...)
+	d.markWrite(ctx)
+
+	return d.query(ctx, d.connection, pgx.ReadWrite, sql, args...)
 }
 
 func (d *Database) QueryRow(ctx context.Context, sql string, args ...any) Row {
-	return d.connection.QueryRow(ctx, sql, args...)
+	d.markWrite(ctx)
+
+	rows, err := d.query(ctx, d.connection, pgx.ReadWrite, sql, args...)
+
+	return &row{rows: rows, err: err}
 }
 
 func (d *Database) Exec(ctx context.Context, sql string, args ...any) (CommandTag, error) {
-	return d.connection.Exec(ctx, sql, args...)
-}
-
-func New(config Config) (*Database, error) {
-	connString := fmt.Sprintf(
-		"user=%s password=%s host=%s port=%s dbname=%s sslmode=%s pool_max_conns=%s",
-		config.User,
-		config.Password,
-		config.Host,
-		config.Port,
-		config.Database,
-		config.SSLMode,
-		config.PoolSize,
-	)
-
-	pgxConfig, err := pgxpool.ParseConfig(connString)
+	d.markWrite(ctx)
+
+	beginQuery, ok := d.statementBeginQuery(ctx, pgx.ReadWrite)
+	if !ok {
+		return d.connection.Exec(ctx, sql, args...)
+	}
+
+	tx, err := d.connection.BeginTx(ctx, pgx.TxOptions{BeginQuery: beginQuery})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return tag, tx.Commit(ctx)
+}
+
+// query runs sql on pool, in a transaction limited to the deadline of ctx
+// when statementBeginQuery asks for one. The transaction ends with the rows.
+func (d *Database) query(ctx context.Context, pool *pgxpool.Pool, mode pgx.TxAccessMode, sql string, args ...any) (Rows, error) {
+	beginQuery, ok := d.statementBeginQuery(ctx, mode)
+	if !ok {
+		return pool.Query(ctx, sql, args...)
+	}
+
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{BeginQuery: beginQuery})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return &txRows{Rows: rows, ctx: ctx, tx: tx}, nil
+}
+
+// txRows commits the transaction of its query once read, or rolls it back
+// when reading failed.
+type txRows struct {
+	pgx.Rows
+	ctx    context.Context
+	tx     pgx.Tx
+	closed bool
+	err    error
+}
+
+func (r *txRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+
+	r.Close()
+
+	return false
+}
+
+func (r *txRows) Close() {
+	if r.closed {
+		return
+	}
+
+	r.closed = true
+	r.Rows.Close()
+
+	if r.Rows.Err() != nil {
+		_ = r.tx.Rollback(r.ctx)
+		return
+	}
+
+	r.err = r.tx.Commit(r.ctx)
+}
+
+func (r *txRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.Rows.Err()
+}
+
+// row scans the first of rows, as pgx does for QueryRow.
+type row struct {
+	rows Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if r.rows.Err() != nil {
+			return r.rows.Err()
+		}
+
+		return pgx.ErrNoRows
+	}
+
+	err := r.rows.Scan(dest...)
+	if err != nil {
+		return err
+	}
+
+	r.rows.Close()
+
+	return r.rows.Err()
+}
+
+// Close stops the replica checks, waits for acquired connections to be
+// released and closes the pools.
+func (d *Database) Close() {
+	if d.checking {
+		close(d.stopChecker)
+		<-d.checkerDone
+	}
+
+	for _, r := range d.replicas {
+		r.pool.Close()
+	}
+
+	d.connection.Close()
+}
+
+func (d *Database) Ping(ctx context.Context) error {
+	return d.connection.Ping(ctx)
+}
+
+// Listen subscribes to a notification channel and calls handle for every
+// payload until ctx is done or the connection breaks. The connection is
+// taken out of the pool for the duration of the call.
+func (d *Database) Listen(ctx context.Context, channel string, handle func(payload string)) error {
+	conn, err := d.connection.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	pgConn := conn.Hijack()
+	defer func() { _ = pgConn.Close(context.Background()) }()
+
+	_, err = pgConn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		handle(notification.Payload)
+	}
+}
+
+// InTx runs fn inside a transaction, committing when fn returns nil and
+// rolling back otherwise.
+func (d *Database) InTx(ctx context.Context, fn func(tx *Tx) error) error {
+	d.markWrite(ctx)
+
+	beginQuery, _ := d.beginQuery(ctx, pgx.ReadWrite)
+
+	tx, err := d.connection.BeginTx(ctx, pgx.TxOptions{BeginQuery: beginQuery})
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	err = fn(&Tx{tx: tx})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// statementBeginQuery is beginQuery for a single statement, which only runs
+// in a transaction with DeadlineTimeouts and when ctx ends before the session
+// statement timeout would stop it.
+func (d *Database) statementBeginQuery(ctx context.Context, mode pgx.TxAccessMode) (string, bool) {
+	if !d.config.DeadlineTimeouts {
+		return "", false
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok || d.config.StatementTimeout > 0 && time.Until(deadline)+timeoutGrace >= d.config.StatementTimeout {
+		return "", false
+	}
+
+	return d.beginQuery(ctx, mode)
+}
+
+// beginQuery is the BEGIN of a transaction whose statement and lock timeouts
+// are capped at the time left until the context deadline. It is sent as one
+// statement, so it takes no more round trips than a plain BEGIN. The
+// timeouts, set slightly past the deadline, stop the query on the server
+// even when the cancel request sent at the deadline is lost. It is false
+// without a deadline.
+func (d *Database) beginQuery(ctx context.Context, mode pgx.TxAccessMode) (string, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return "", false
+	}
+
+	remaining := time.Until(deadline) + timeoutGrace
+	if remaining < time.Millisecond {
+		// Zero would disable the timeouts altogether.
+		remaining = time.Millisecond
+	}
+
+	query := "BEGIN"
+	if mode == pgx.ReadOnly {
+		query += " READ ONLY"
+	}
+
+	for _, setting := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"statement_timeout", d.config.StatementTimeout},
+		{"lock_timeout", d.config.LockTimeout},
+	} {
+		timeout := remaining
+		if setting.timeout > 0 && setting.timeout < timeout {
+			timeout = setting.timeout
+		}
+
+		query += fmt.Sprintf("; SET LOCAL %s = %d", setting.name, timeout.Milliseconds())
+	}
+
+	return query, true
+}
+
+type Tx struct {
+	tx pgx.Tx
+}
+
+func (t *Tx) Query(ctx context.Context, sql string, args ...any) (Rows, error) {
+	return t.tx.Query(ctx, sql, args...)
+}
+
+func (t *Tx) QueryRow(ctx context.Context, sql string, args ...any) Row {
+	return t.tx.QueryRow(ctx, sql, args...)
+}
+
+func (t *Tx) Exec(ctx context.Context, sql string, args ...any) (CommandTag, error) {
+	return t.tx.Exec(ctx, sql, args...)
+}
+
+// IsUniqueViolation reports whether err is a unique violation of the given
+// constraint. An empty constraint matches any unique violation.
+func IsUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolationCode {
+		return false
+	}
+
+	return constraint == "" || pgErr.ConstraintName == constraint
+}
+
+func New(config Config, log *zap.Logger) (*Database, error) {
+	conn, err := newPool(config, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{
+		config:      config,
+		connection:  conn,
+		stopChecker: make(chan struct{}),
+		checkerDone: make(chan struct{}),
+	}
+
+	err = db.waitForPrimary(log)
+	if err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	for _, r := range config.Replicas {
+		pool, err := newPool(config, r.Host, r.Port)
+		if err != nil {
+			db.Close()
+
+			return nil, errors.Wrapf(err, "replica %s:%s", r.Host, r.Port)
+		}
+
+		db.replicas = append(db.replicas, &replica{name: r.Host + ":" + r.Port, pool: pool})
+	}
+
+	return db, nil
+}
+
+// waitForPrimary pings the primary until it answers or StartupTimeout runs
+// out, so that the service may start before Postgres does.
+func (d *Database) waitForPrimary(log *zap.Logger) error {
+	if d.config.StartupTimeout <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.StartupTimeout)
+	defer cancel()
+
+	backoff := initialStartupBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := d.connection.Ping(ctx)
+		if err == nil {
+			if attempt > 1 {
+				log.Info("database is up", zap.Int("attempts", attempt))
+			}
+
+			return nil
+		}
+
+		log.Warn("database is not ready, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Wrapf(err, "database not ready after %s", d.config.StartupTimeout)
+		}
+
+		backoff = min(backoff*2, maxStartupBackoff)
+	}
+}
+
+// newPool connects to the primary, or to host and port when given, which
+// replace those of the primary for a replica.
+func newPool(config Config, host, port string) (*pgxpool.Pool, error) {
+	pgxConfig, err := pgxpool.ParseConfig(config.PostgresDSN())
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := pgxpool.NewWithConfig(context.Background(), pgxConfig)
+	if host != "" {
+		replicaPort, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid port")
+		}
+
+		pgxConfig.ConnConfig.Host = host
+		pgxConfig.ConnConfig.Port = uint16(replicaPort)
+		pgxConfig.ConnConfig.Fallbacks = nil
+	}
+
+	set, err := dsnSettings(config.PostgresDSN())
 	if err != nil {
 		return nil, err
 	}
 
-	return &Database{
-		connection: conn,
-	}, nil
+	if config.PoolSize != "" && !set["pool_max_conns"] {
+		maxConns, err := strconv.ParseInt(config.PoolSize, 10, 32)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid pool size")
+		}
+
+		pgxConfig.MaxConns = int32(maxConns)
+	}
+
+	if config.MinConns > 0 && !set["pool_min_conns"] {
+		pgxConfig.MinConns = config.MinConns
+	}
+
+	if config.MaxConnLifetime > 0 && !set["pool_max_conn_lifetime"] {
+		pgxConfig.MaxConnLifetime = config.MaxConnLifetime
+	}
+
+	if config.MaxConnIdleTime > 0 && !set["pool_max_conn_idle_time"] {
+		pgxConfig.MaxConnIdleTime = config.MaxConnIdleTime
+	}
+
+	if config.HealthCheckPeriod > 0 && !set["pool_health_check_period"] {
+		pgxConfig.HealthCheckPeriod = config.HealthCheckPeriod
+	}
+
+	if config.QueryExecMode != "" && !set["default_query_exec_mode"] {
+		pgxConfig.ConnConfig.DefaultQueryExecMode = queryExecModes[config.QueryExecMode]
+	}
+
+	pgxConfig.ConnConfig.Tracer = multitracer.New(metricsTracer{}, traceTracer{database: pgxConfig.ConnConfig.Database})
+	// Ask the server to cancel the running query when the context is done
+	// instead of only dropping the connection, which would leave the query
+	// running until it notices.
+	pgxConfig.ConnConfig.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{
+			Conn:          conn,
+			DeadlineDelay: cancelDeadlineDelay,
+		}
+	}
+
+	if config.StatementTimeout > 0 && !set["statement_timeout"] {
+		pgxConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(config.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if config.LockTimeout > 0 && !set["lock_timeout"] {
+		pgxConfig.ConnConfig.RuntimeParams["lock_timeout"] = strconv.FormatInt(config.LockTimeout.Milliseconds(), 10)
+	}
+
+	return pgxpool.NewWithConfig(context.Background(), pgxConfig)
+}
+
+// dsnSettings returns the keys set by a connection string, in either the URL
+// or the keyword/value form, so that the config only fills in the rest.
+func dsnSettings(dsn string) (map[string]bool, error) {
+	set := map[string]bool{}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid database url")
+		}
+
+		for key := range u.Query() {
+			set[key] = true
+		}
+
+		return set, nil
+	}
+
+	for s := strings.TrimSpace(dsn); s != ""; s = strings.TrimSpace(s) {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, errors.New("invalid database dsn")
+		}
+
+		set[strings.TrimSpace(key)] = true
+		s = strings.TrimLeft(rest, " \t\n\r")
+
+		if !strings.HasPrefix(s, "'") {
+			end := strings.IndexAny(s, " \t\n\r")
+			if end < 0 {
+				end = len(s)
+			}
+
+			s = s[end:]
+
+			continue
+		}
+
+		// Skip the quoted value, where a backslash escapes the next byte.
+		end := 1
+		for ; end < len(s) && s[end] != '\''; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+
+		if end >= len(s) {
+			return nil, errors.New("invalid database dsn: unterminated quoted value")
+		}
+
+		s = s[end+1:]
+	}
+
+	return set, nil
 }
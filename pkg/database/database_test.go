@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBeginQuery(t *testing.T) {
+	d := &Database{config: Config{StatementTimeout: 30 * time.Second, LockTimeout: 2 * time.Second}}
+
+	_, ok := d.beginQuery(context.Background(), pgx.ReadWrite)
+	assert.False(t, ok, "no deadline, no transaction")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query, ok := d.beginQuery(ctx, pgx.ReadOnly)
+	assert.True(t, ok)
+
+	match := regexp.MustCompile(`^BEGIN READ ONLY; SET LOCAL statement_timeout = (\d+); SET LOCAL lock_timeout = 2000$`).FindStringSubmatch(query)
+	if assert.NotNil(t, match, query) {
+		statementTimeout, _ := strconv.Atoi(match[1])
+		assert.InDelta(t, 5100, statementTimeout, 100, "the deadline with the grace, under the configured timeout")
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Minute))
+	defer cancel()
+
+	query, _ = d.beginQuery(expired, pgx.ReadWrite)
+	assert.Equal(t, "BEGIN; SET LOCAL statement_timeout = 1; SET LOCAL lock_timeout = 1", query, "never zero, which disables the timeouts")
+}
+
+func TestStatementBeginQuery(t *testing.T) {
+	short, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	long, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, tt := range []struct {
+		name   string
+		config Config
+		ctx    context.Context
+		want   bool
+	}{
+		{name: "off", config: Config{StatementTimeout: 30 * time.Second}, ctx: short},
+		{name: "no deadline", config: Config{DeadlineTimeouts: true, StatementTimeout: 30 * time.Second}, ctx: context.Background()},
+		{name: "deadline after the session timeout", config: Config{DeadlineTimeouts: true, StatementTimeout: 30 * time.Second}, ctx: long},
+		{name: "deadline before the session timeout", config: Config{DeadlineTimeouts: true, StatementTimeout: 30 * time.Second}, ctx: short, want: true},
+		{name: "no session timeout", config: Config{DeadlineTimeouts: true}, ctx: long, want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Database{config: tt.config}
+
+			_, ok := d.statementBeginQuery(tt.ctx, pgx.ReadOnly)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+}
+
+func TestWritesAreForgottenWithoutReplicas(t *testing.T) {
+	d, err := New(Config{
+		URL:                  "postgres://localhost:1/test",
+		ReadYourWrites:       10 * time.Millisecond,
+		ReplicaCheckInterval: 5 * time.Millisecond,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	require.NoError(t, d.OnStart(context.Background()))
+	t.Cleanup(d.Close)
+
+	d.markWrite(d.WithSession(context.Background(), "user:1"))
+
+	assert.True(t, Pinned(d.WithSession(context.Background(), "user:1")))
+	assert.Eventually(t, func() bool {
+		_, ok := d.writes.Load("user:1")
+		return !ok
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestURLSettingsWin(t *testing.T) {
+	config := Config{
+		PoolSize:         "10",
+		MaxConnLifetime:  time.Hour,
+		QueryExecMode:    "cache_statement",
+		StatementTimeout: 30 * time.Second,
+	}
+
+	for _, tt := range []struct {
+		name string
+		url  string
+		want func(t *testing.T, pool *pgxpool.Config)
+	}{
+		{
+			name: "url leaves the settings out",
+			url:  "postgres://user@localhost:5432/test",
+			want: func(t *testing.T, pool *pgxpool.Config) {
+				assert.EqualValues(t, 10, pool.MaxConns)
+				assert.Equal(t, time.Hour, pool.MaxConnLifetime)
+				assert.Equal(t, pgx.QueryExecModeCacheStatement, pool.ConnConfig.DefaultQueryExecMode)
+				assert.Equal(t, "30000", pool.ConnConfig.RuntimeParams["statement_timeout"])
+			},
+		},
+		{
+			name: "url sets them",
+			url:  "postgres://user@localhost:5432/test?pool_max_conns=3&pool_max_conn_lifetime=5m&default_query_exec_mode=exec&statement_timeout=1000",
+			want: func(t *testing.T, pool *pgxpool.Config) {
+				assert.EqualValues(t, 3, pool.MaxConns)
+				assert.Equal(t, 5*time.Minute, pool.MaxConnLifetime)
+				assert.Equal(t, pgx.QueryExecModeExec, pool.ConnConfig.DefaultQueryExecMode)
+				assert.Equal(t, "1000", pool.ConnConfig.RuntimeParams["statement_timeout"])
+			},
+		},
+		{
+			name: "keyword/value dsn sets them",
+			url:  "host=localhost application_name='a b\\'c' pool_max_conns = 3 default_query_exec_mode=exec",
+			want: func(t *testing.T, pool *pgxpool.Config) {
+				assert.EqualValues(t, 3, pool.MaxConns)
+				assert.Equal(t, time.Hour, pool.MaxConnLifetime)
+				assert.Equal(t, pgx.QueryExecModeExec, pool.ConnConfig.DefaultQueryExecMode)
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config.URL = tt.url
+
+			pool, err := newPool(config, "", "")
+			require.NoError(t, err)
+			t.Cleanup(pool.Close)
+
+			tt.want(t, pool.Config())
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package dbtest connects tests to a disposable Postgres database, which
+// they skip without.
+package dbtest
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/pkg/migration"
+	"github.com/vorotilkin/twitter-users/schema/migrations"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"testing"
+)
+
+// DSNEnv names a disposable database the tests migrate and truncate.
+const DSNEnv = "TEST_DATABASE_URL"
+
+// DSN returns the database DSNEnv names, migrated, or skips t when it is not
+// set.
+func DSN(t *testing.T) string {
+	t.Helper()
+
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", DSNEnv)
+	}
+
+	err := migration.Do(zap.NewNop(), migration.Config{NeedMigration: true}, dsn, migrations.FS)
+	if err != nil {
+		t.Fatalf("dbtest: migrate: %v", err)
+	}
+
+	return dsn
+}
+
+// New connects to the database of DSN, closed when t ends.
+func New(t *testing.T) *database.Database {
+	t.Helper()
+
+	db, err := database.New(database.Config{URL: DSN(t)}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("dbtest: connect: %v", err)
+	}
+
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+// Truncate empties tables and those referencing them, restarting their
+// identities.
+func Truncate(t *testing.T, db *database.Database, tables ...string) {
+	t.Helper()
+
+	names := make([]string, 0, len(tables))
+	for _, table := range tables {
+		names = append(names, pgx.Identifier{table}.Sanitize())
+	}
+
+	_, err := db.Exec(context.Background(), "TRUNCATE "+strings.Join(names, ", ")+" RESTART IDENTITY CASCADE")
+	if err != nil {
+		t.Fatalf("dbtest: truncate: %v", err)
+	}
+}
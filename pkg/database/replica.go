@@ -0,0 +1,285 @@
+package database
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultReplicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout         = 2 * time.Second
+)
+
+var (
+	replicaHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "db_replica_healthy",
+		Help: "Whether a read replica currently receives reads.",
+	}, []string{"replica"})
+	replicaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "db_replica_lag_seconds",
+		Help: "How far a read replica is behind the primary, as of its last check.",
+	}, []string{"replica"})
+)
+
+// replicaLagQuery measures how far a replica is behind. A replica that has
+// replayed all it received is current, however long ago the primary last
+// committed.
+const replicaLagQuery = `
+SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+// Replica is a read-only copy of the primary. It shares the credentials,
+// database name and pool settings of the primary.
+type Replica struct {
+	Host string
+	Port string
+}
+
+type replica struct {
+	name    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+func (r *replica) setHealthy(healthy bool) {
+	r.healthy.Store(healthy)
+
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+
+	replicaHealthy.WithLabelValues(r.name).Set(value)
+}
+
+type sessionKey struct{}
+
+type primaryKey struct{}
+
+// session tracks the writes made while serving one request.
+type session struct {
+	caller string
+	pinned bool
+	wrote  atomic.Bool
+}
+
+// WithSession starts a request made by caller, an opaque key such as a user
+// ID. Reads of the request go to the primary once it writes, and from the
+// start when the caller wrote within the last ReadYourWrites. An empty caller
+// is anonymous and only pinned by its own writes.
+func (d *Database) WithSession(ctx context.Context, caller string) context.Context {
+	s := &session{caller: caller}
+
+	if caller != "" && d.config.ReadYourWrites > 0 {
+		if wroteAt, ok := d.writes.Load(caller); ok {
+			s.pinned = time.Since(wroteAt.(time.Time)) < d.config.ReadYourWrites
+		}
+	}
+
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// Pinned reports whether reads made with ctx must see the writes of the
+// caller and so cannot be served by a replica.
+func Pinned(ctx context.Context) bool {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+
+	return ok && (s.pinned || s.wrote.Load())
+}
+
+// WithPrimary sends the reads made with ctx to the primary, for results that
+// outlive the request, such as cached ones, and must not lag behind.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// ReadsPrimary reports whether reads made with ctx go to the primary, as
+// asked with WithPrimary or because the session is pinned.
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+
+	return primary || Pinned(ctx)
+}
+
+// markWrite pins the session of ctx to the primary. Every statement sent to
+// the primary counts, as the repositories only go there to write or to read
+// what they must not miss.
+func (d *Database) markWrite(ctx context.Context) {
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	if !ok {
+		return
+	}
+
+	s.wrote.Store(true)
+
+	if s.caller != "" && d.config.ReadYourWrites > 0 {
+		d.writes.Store(s.caller, time.Now())
+	}
+}
+
+// ReadQuery runs a read-only query on a healthy replica, or on the primary
+// when there is none or the session is pinned.
+func (d *Database) ReadQuery(ctx context.Context, sql string, args ...any) (Rows, error) {
+	r := d.reader(ctx)
+	if r == nil {
+		return d.query(ctx, d.connection, pgx.ReadOnly, sql, args...)
+	}
+
+	rows, err := d.query(ctx, r.pool, pgx.ReadOnly, sql, args...)
+	d.checkReadErr(ctx, r, err)
+
+	return rows, err
+}
+
+// ReadQueryRow is the QueryRow counterpart of ReadQuery.
+func (d *Database) ReadQueryRow(ctx context.Context, sql string, args ...any) Row {
+	r := d.reader(ctx)
+	pool := d.connection
+	if r != nil {
+		pool = r.pool
+	}
+
+	rows, err := d.query(ctx, pool, pgx.ReadOnly, sql, args...)
+	if r == nil {
+		return &row{rows: rows, err: err}
+	}
+
+	return &replicaRow{Row: &row{rows: rows, err: err}, ctx: ctx, db: d, replica: r}
+}
+
+type replicaRow struct {
+	Row
+	ctx     context.Context
+	db      *Database
+	replica *replica
+}
+
+func (r *replicaRow) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	r.db.checkReadErr(r.ctx, r.replica, err)
+
+	return err
+}
+
+// reader picks the next healthy replica in turn, or nil for the primary.
+func (d *Database) reader(ctx context.Context) *replica {
+	if len(d.replicas) == 0 || ReadsPrimary(ctx) {
+		return nil
+	}
+
+	start := d.next.Add(1)
+	for i := range uint32(len(d.replicas)) {
+		r := d.replicas[(start+i)%uint32(len(d.replicas))]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// checkReadErr takes a replica out of rotation when it fails to answer
+// rather than rejecting the query. The health check brings it back.
+func (d *Database) checkReadErr(ctx context.Context, r *replica, err error) {
+	var pgErr *pgconn.PgError
+	if err == nil || ctx.Err() != nil || errors.As(err, &pgErr) {
+		return
+	}
+
+	r.setHealthy(false)
+}
+
+// OnStart starts checking the replicas in the background. They receive no
+// reads until they pass their first check. The same loop forgets the writes
+// that no longer pin their caller, which are recorded with or without
+// replicas.
+func (d *Database) OnStart(context.Context) error {
+	if len(d.replicas) == 0 && d.config.ReadYourWrites <= 0 {
+		return nil
+	}
+
+	interval := d.config.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+
+	d.checking = true
+
+	go func() {
+		defer close(d.checkerDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			d.checkReplicas()
+			d.forgetWrites()
+
+			select {
+			case <-ticker.C:
+			case <-d.stopChecker:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (d *Database) checkReplicas() {
+	var wg sync.WaitGroup
+
+	for _, r := range d.replicas {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+			defer cancel()
+
+			r.setHealthy(d.checkReplica(ctx, r))
+		}()
+	}
+
+	wg.Wait()
+}
+
+// checkReplica reports whether r answers and, with MaxReplicaLag set, keeps
+// up with the primary.
+func (d *Database) checkReplica(ctx context.Context, r *replica) bool {
+	if d.config.MaxReplicaLag <= 0 {
+		return r.pool.Ping(ctx) == nil
+	}
+
+	var seconds float64
+	if err := r.pool.QueryRow(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+		return false
+	}
+
+	lag := time.Duration(seconds * float64(time.Second))
+	replicaLag.WithLabelValues(r.name).Set(lag.Seconds())
+
+	return lag <= d.config.MaxReplicaLag
+}
+
+// forgetWrites drops the writes that no longer pin their caller.
+func (d *Database) forgetWrites() {
+	d.writes.Range(func(caller, wroteAt any) bool {
+		if time.Since(wroteAt.(time.Time)) >= d.config.ReadYourWrites {
+			d.writes.Delete(caller)
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"google.golang.org/grpc/metadata"
+	"net"
+	"net/http"
+)
+
+const (
+	metadataPrefix    = "x-gateway-"
+	clientIPMetadata  = metadataPrefix + "client-ip"
+	secretMetadataKey = metadataPrefix + "secret"
+)
+
+// Secret authenticates the client address the gateway adds to the calls it
+// proxies, which would otherwise all come from the address of the gateway.
+// It is generated per process, so only the in-process gateway knows it.
+type Secret string
+
+func NewSecret() (Secret, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return Secret(hex.EncodeToString(b)), nil
+}
+
+// ClientIP returns the address of the HTTP client of a call proxied by the
+// gateway holding s. It is false for calls made directly over gRPC.
+func (s Secret) ClientIP(ctx context.Context) (string, bool) {
+	if s == "" {
+		return "", false
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	secrets, ips := md.Get(secretMetadataKey), md.Get(clientIPMetadata)
+	if len(secrets) != 1 || len(ips) != 1 || subtle.ConstantTimeCompare([]byte(secrets[0]), []byte(s)) != 1 {
+		return "", false
+	}
+
+	return ips[0], true
+}
+
+func (s Secret) metadata(_ context.Context, r *http.Request) metadata.MD {
+	if s == "" {
+		return nil
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return metadata.Pairs(clientIPMetadata, ip, secretMetadataKey, string(s))
+}
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/v1/users", nil)
+	r.RemoteAddr = "203.0.113.1:40000"
+
+	ctx := metadata.NewIncomingContext(context.Background(), secret.metadata(context.Background(), r))
+
+	ip, ok := secret.ClientIP(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "203.0.113.1", ip)
+
+	other, err := NewSecret()
+	require.NoError(t, err)
+
+	_, ok = other.ClientIP(ctx)
+	assert.False(t, ok, "another secret")
+
+	_, ok = Secret("").ClientIP(metadata.NewIncomingContext(context.Background(), metadata.Pairs(clientIPMetadata, "203.0.113.1", secretMetadataKey, "")))
+	assert.False(t, ok, "no secret")
+
+	_, ok = secret.ClientIP(context.Background())
+	assert.False(t, ok, "direct call")
+}
+
+func TestIncomingHeaderDropsGatewayMetadata(t *testing.T) {
+	for _, header := range []string{"Grpc-Metadata-X-Gateway-Secret", "Grpc-Metadata-X-Gateway-Client-Ip", "grpc-metadata-x-gateway-client-ip"} {
+		_, ok := incomingHeader(header)
+		assert.False(t, ok, header)
+	}
+
+	key, ok := incomingHeader("Grpc-Metadata-Trace")
+	assert.True(t, ok)
+	assert.Equal(t, "Trace", key)
+}
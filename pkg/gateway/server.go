@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/vorotilkin/twitter-users/pkg/certs"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	openAPIPath     = "/openapi.json"
+	requestIDHeader = "X-Request-Id"
+)
+
+type Config struct {
+	Enabled bool
+	Address string
+	// Endpoint is the gRPC address the gateway proxies to.
+	Endpoint string
+	TLS      TLSConfig
+}
+
+// TLSConfig secures the connection to Endpoint. CertFile and KeyFile are
+// only needed when the gRPC server requires client certificates.
+type TLSConfig struct {
+	Enabled    bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+// Registrar binds generated gateway handlers to the mux, e.g. proto.RegisterUsersHandler.
+type Registrar func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// Server translates REST/JSON requests into calls on the gRPC server. Requests
+// go through the gRPC listener, so every interceptor applies to them as well.
+type Server struct {
+	config     Config
+	logger     *zap.Logger
+	server     *http.Server
+	mux        *runtime.ServeMux
+	registrars []Registrar
+	conn       *grpc.ClientConn
+	reloader   *certs.Reloader
+}
+
+func (s *Server) OnStart(ctx context.Context) error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	creds, err := s.credentials()
+	if err != nil {
+		return fmt.Errorf("failed to load certificates: %v", err)
+	}
+
+	conn, err := grpc.NewClient(s.config.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to dial grpc endpoint: %v", err)
+	}
+	s.conn = conn
+
+	for _, register := range s.registrars {
+		err = register(ctx, s.mux, conn)
+		if err != nil {
+			return fmt.Errorf("failed to register gateway handler: %v", err)
+		}
+	}
+
+	lis, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	go func(listener net.Listener) {
+		s.logger.Info("gateway server listening on", zap.String("address", s.config.Address))
+
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("failed to serve gateway", zap.Error(err))
+		}
+	}(lis)
+
+	return nil
+}
+
+func (s *Server) OnStop(ctx context.Context) error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	s.logger.Info("gateway shutting down, finishing in-flight calls")
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.logger.Warn("gateway shutdown cut off calls", zap.Error(err))
+	} else {
+		s.logger.Info("gateway stopped")
+	}
+
+	if s.conn != nil {
+		err = errors.Join(err, s.conn.Close())
+	}
+	if s.reloader != nil {
+		err = errors.Join(err, s.reloader.Close())
+	}
+
+	return err
+}
+
+// credentials reload the client certificate on change; the CA bundle is read
+// once per dial.
+func (s *Server) credentials() (credentials.TransportCredentials, error) {
+	if !s.config.TLS.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	reloader, err := certs.NewReloader(s.config.TLS.CertFile, s.config.TLS.KeyFile, s.config.TLS.CAFile, s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = reloader.Watch()
+	if err != nil {
+		return nil, err
+	}
+	s.reloader = reloader
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              reloader.CAs(),
+		ServerName:           s.config.TLS.ServerName,
+		GetClientCertificate: reloader.ClientCertificate,
+	}), nil
+}
+
+// errorHandler renders errors through the default handler, which maps gRPC
+// codes to HTTP statuses with runtime.HTTPStatusFromCode, and logs the ones
+// that point to a server-side failure.
+func (s *Server) errorHandler(
+	ctx context.Context,
+	mux *runtime.ServeMux,
+	marshaler runtime.Marshaler,
+	w http.ResponseWriter,
+	r *http.Request,
+	err error,
+) {
+	switch status.Code(err) {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		s.logger.Error("gateway request failed",
+			zap.String("request_id", r.Header.Get(requestIDHeader)),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+	}
+
+	runtime.DefaultHTTPErrorHandler(ctx, mux, marshaler, w, r, err)
+}
+
+func NewServer(c Config, log *zap.Logger, secret Secret, openAPI []byte, registrars ...Registrar) *Server {
+	s := &Server{
+		config:     c,
+		logger:     log,
+		registrars: registrars,
+	}
+
+	s.mux = runtime.NewServeMux(
+		runtime.WithErrorHandler(s.errorHandler),
+		runtime.WithIncomingHeaderMatcher(incomingHeader),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+		runtime.WithMetadata(secret.metadata),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", withRequestID(s.mux))
+	mux.HandleFunc(openAPIPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPI)
+	})
+
+	s.server = &http.Server{Handler: mux}
+
+	return s
+}
+
+// withRequestID makes sure every proxied call carries a request ID, so gateway
+// and gRPC logs of the same request share it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requestid.Valid(r.Header.Get(requestIDHeader)) {
+			r.Header.Set(requestIDHeader, requestid.New())
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// incomingHeader drops headers that would pass for the metadata only the
+// gateway sets.
+func incomingHeader(key string) (string, bool) {
+	if strings.EqualFold(key, requestIDHeader) {
+		return requestid.MetadataKey, true
+	}
+
+	name, ok := runtime.DefaultHeaderMatcher(key)
+	if ok && strings.HasPrefix(strings.ToLower(name), metadataPrefix) {
+		return "", false
+	}
+
+	return name, ok
+}
+
+func outgoingHeader(key string) (string, bool) {
+	if key == requestid.MetadataKey {
+		return requestIDHeader, true
+	}
+
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+func (c Config) Validate() error {
+	if c.Enabled && c.Address == "" {
+		return errors.New("address is required when the gateway is enabled")
+	}
+
+	if c.TLS.Enabled && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls.certFile and tls.keyFile must be set together")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// DeadlineConfig bounds unary calls whose client did not set a deadline.
+// Streams are long-lived by design and are left alone.
+type DeadlineConfig struct {
+	Default time.Duration
+	Methods []MethodDeadline
+}
+
+type MethodDeadline struct {
+	Method  string
+	Timeout time.Duration
+}
+
+// UnaryServerDeadlineInterceptor applies the configured deadline when the
+// client sent none, and reports calls that ran out of time as
+// DeadlineExceeded or Canceled whatever error the handler wrapped.
+func UnaryServerDeadlineInterceptor(c DeadlineConfig) grpc.UnaryServerInterceptor {
+	timeouts := make(map[string]time.Duration, len(c.Methods))
+	for _, method := range c.Methods {
+		timeouts[method.Method] = method.Timeout
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			timeout, ok := timeouts[info.FullMethod]
+			if !ok {
+				timeout = c.Default
+			}
+
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+		}
+
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return nil, status.Error(codes.DeadlineExceeded, "deadline exceeded")
+		case errors.Is(ctx.Err(), context.Canceled):
+			return nil, status.Error(codes.Canceled, "call canceled")
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,91 @@
+package grpc
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+const (
+	typeUnary        = "unary"
+	typeClientStream = "client_stream"
+	typeServerStream = "server_stream"
+	typeBidiStream   = "bidi_stream"
+)
+
+// Metric names follow go-grpc-prometheus so existing dashboards keep working.
+var (
+	serverStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "Total number of RPCs started on the server.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+	serverHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+	serverHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Histogram of response latency of RPCs handled by the server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+)
+
+func UnaryServerMetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done := observe(typeUnary, info.FullMethod)
+
+		resp, err := handler(ctx, req)
+		done(err)
+
+		return resp, err
+	}
+}
+
+func StreamServerMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := observe(streamType(info), info.FullMethod)
+
+		err := handler(srv, ss)
+		done(err)
+
+		return err
+	}
+}
+
+func observe(rpcType, fullMethod string) func(err error) {
+	service, method := splitMethodName(fullMethod)
+	start := time.Now()
+
+	serverStarted.WithLabelValues(rpcType, service, method).Inc()
+
+	return func(err error) {
+		serverHandled.WithLabelValues(rpcType, service, method, status.Code(err).String()).Inc()
+		serverHandlingSeconds.WithLabelValues(rpcType, service, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return typeBidiStream
+	case info.IsClientStream:
+		return typeClientStream
+	default:
+		return typeServerStream
+	}
+}
+
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+
+	service, method, ok := strings.Cut(fullMethod, "/")
+	if !ok {
+		return "unknown", "unknown"
+	}
+
+	return service, method
+}
@@ -0,0 +1,65 @@
+package grpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"testing"
+)
+
+// panickingServiceDesc panics in Unary and in Stream unless the request
+// comes from Unary with ok set.
+var panickingServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Panicking",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Unary",
+		Handler: func(_ any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			info := &grpc.UnaryServerInfo{FullMethod: "/test.Panicking/Unary"}
+
+			return interceptor(ctx, &emptypb.Empty{}, info, func(context.Context, any) (any, error) {
+				panic("boom")
+			})
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Stream",
+		ServerStreams: true,
+		Handler: func(any, grpc.ServerStream) error {
+			panic("boom")
+		},
+	}},
+}
+
+func TestRecovery(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	_, conn := startServer(t, Config{}, zap.New(core), &panickingServiceDesc, struct{}{})
+	ctx := context.Background()
+
+	err := conn.Invoke(ctx, "/test.Panicking/Unary", &emptypb.Empty{}, &emptypb.Empty{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "internal error", status.Convert(err).Message(), "the panic value is not sent back")
+
+	stream, err := conn.NewStream(ctx, &panickingServiceDesc.Streams[0], "/test.Panicking/Stream")
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+
+	err = stream.RecvMsg(&emptypb.Empty{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	err = conn.Invoke(ctx, "/test.Panicking/Unary", &emptypb.Empty{}, &emptypb.Empty{})
+	assert.Equal(t, codes.Internal, status.Code(err), "the server survives and keeps answering")
+
+	recovered := logs.FilterMessage("recovered from panic").All()
+	require.Len(t, recovered, 3)
+	assert.Equal(t, "/test.Panicking/Unary", recovered[0].ContextMap()["method"])
+	assert.Equal(t, "/test.Panicking/Stream", recovered[1].ContextMap()["method"])
+	assert.NotEmpty(t, recovered[0].ContextMap()["stack"])
+}
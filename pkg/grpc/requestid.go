@@ -0,0 +1,42 @@
+package grpc
+
+import (
+	"context"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServerRequestIDInterceptor takes the request ID from the caller's
+// metadata or generates one, puts it into the context and the grpc_ctxtags
+// picked up by the logging interceptor, and echoes it in the response header.
+func UnaryServerRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(withRequestID(ctx), req)
+	}
+}
+
+func StreamServerRequestIDInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = withRequestID(ss.Context())
+
+		return handler(srv, wrapped)
+	}
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if values := metadata.ValueFromIncomingContext(ctx, requestid.MetadataKey); len(values) > 0 && requestid.Valid(values[0]) {
+		id = values[0]
+	} else {
+		id = requestid.New()
+	}
+
+	grpc_ctxtags.Extract(ctx).Set("request_id", id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestid.MetadataKey, id))
+
+	return requestid.WithID(ctx, id)
+}
@@ -0,0 +1,93 @@
+package grpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"strings"
+	"testing"
+)
+
+// echoService records the request ID its handler sees.
+type echoService struct {
+	ids chan string
+}
+
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			info := &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Echo"}
+
+			return interceptor(ctx, &emptypb.Empty{}, info, func(ctx context.Context, _ any) (any, error) {
+				id, _ := requestid.FromContext(ctx)
+				srv.(*echoService).ids <- id
+
+				return &emptypb.Empty{}, nil
+			})
+		},
+	}},
+}
+
+func TestRequestID(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	service := &echoService{ids: make(chan string, 1)}
+	_, conn := startServer(t, Config{}, zap.New(core), &echoServiceDesc, service)
+
+	for _, tt := range []struct {
+		name     string
+		incoming string
+		kept     bool
+	}{
+		{name: "missing"},
+		{name: "valid", incoming: "req-42", kept: true},
+		{name: "too long", incoming: strings.Repeat("a", 129)},
+		{name: "with a space", incoming: "req 42"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.incoming != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, tt.incoming)
+			}
+
+			var header metadata.MD
+
+			err := conn.Invoke(ctx, "/test.Echo/Echo", &emptypb.Empty{}, &emptypb.Empty{}, grpc.Header(&header))
+			require.NoError(t, err)
+
+			id := <-service.ids
+			assert.True(t, requestid.Valid(id), id)
+			assert.Equal(t, []string{id}, header.Get(requestid.MetadataKey), "echoed in the response header")
+
+			if tt.kept {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.NotEqual(t, tt.incoming, id, "replaced by a generated id")
+			}
+
+			finished := logs.TakeAll()
+			require.NotEmpty(t, finished)
+			assert.Equal(t, id, finished[len(finished)-1].ContextMap()["request_id"], "in the fields of the call log")
+		})
+	}
+}
+
+// Clients such as grpc-go refuse to send control characters, which other
+// clients and proxies may still pass on.
+func TestRequestIDReplacesNonPrintable(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestid.MetadataKey, "req\x01"))
+
+	id, ok := requestid.FromContext(withRequestID(ctx))
+	require.True(t, ok)
+	assert.NotEqual(t, "req\x01", id)
+	assert.True(t, requestid.Valid(id))
+}
@@ -2,31 +2,111 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/vorotilkin/twitter-users/pkg/auth"
+	"github.com/vorotilkin/twitter-users/pkg/certs"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"net"
+	"strings"
+	"sync"
+	"time"
 )
 
+const defaultStopTimeout = 10 * time.Second
+
 type Config struct {
-	Address string
+	Address   string
+	TLS       TLSConfig
+	Deadlines DeadlineConfig
+	Shutdown  ShutdownConfig
+}
+
+type ShutdownConfig struct {
+	// DrainPeriod keeps serving after health turns NOT_SERVING, giving load
+	// balancers time to stop routing new calls here.
+	DrainPeriod time.Duration
+	// Timeout bounds the graceful stop; calls still running after it, such as
+	// health watch streams, are cut off.
+	Timeout time.Duration
+}
+
+// Interceptors are chained after the built-in request ID, metrics, logging,
+// recovery and deadline ones.
+type Interceptors struct {
+	Unary  []grpc.UnaryServerInterceptor
+	Stream []grpc.StreamServerInterceptor
 }
 
 type Server struct {
-	config Config
-	logger *zap.Logger
-	server *grpc.Server
+	config   Config
+	logger   *zap.Logger
+	server   *grpc.Server
+	health   *health.Server
+	reloader *certs.Reloader
+	mu       sync.Mutex
+	services []string
+	serving  bool
+	listener net.Listener
+	drain    sync.Once
 }
 
 func (s *Server) RegisterService(sd *grpc.ServiceDesc, ss any) {
 	s.server.RegisterService(sd, ss)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.services = append(s.services, sd.ServiceName)
+	s.health.SetServingStatus(sd.ServiceName, servingStatus(s.serving))
+}
+
+// SetServing reports every registered service and the server as a whole as
+// SERVING or NOT_SERVING through the grpc.health.v1 service.
+func (s *Server) SetServing(serving bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serving != serving {
+		s.logger.Info("grpc health status changed", zap.Bool("serving", serving))
+	}
+
+	s.serving = serving
+	s.health.SetServingStatus("", servingStatus(serving))
+
+	for _, service := range s.services {
+		s.health.SetServingStatus(service, servingStatus(serving))
+	}
+}
+
+// UseListener makes OnStart serve on lis instead of listening on the
+// configured address, such as an in-memory listener in tests.
+func (s *Server) UseListener(lis net.Listener) {
+	s.listener = lis
 }
 
 func (s *Server) OnStart(_ context.Context) error {
-	lis, err := net.Listen("tcp4", s.config.Address)
-	if err != nil {
-		return fmt.Errorf("failed to listen: %v", err)
+	if s.reloader != nil {
+		err := s.reloader.Watch()
+		if err != nil {
+			return fmt.Errorf("failed to watch certificates: %v", err)
+		}
+	}
+
+	lis := s.listener
+	if lis == nil {
+		var err error
+		lis, err = net.Listen("tcp4", s.config.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen: %v", err)
+		}
 	}
 
 	go func(listener net.Listener) {
@@ -41,16 +121,158 @@ func (s *Server) OnStart(_ context.Context) error {
 	return nil
 }
 
-func (s *Server) OnStop(_ context.Context) error {
-	s.server.GracefulStop()
+// Drain reports NOT_SERVING and keeps serving for the drain period, so that
+// load balancers stop routing new calls here. Only the first call waits;
+// proxies in front of the server, such as the gateway, drain before it stops.
+func (s *Server) Drain(ctx context.Context) {
+	s.drain.Do(func() {
+		s.logger.Info("grpc server shutting down, reporting NOT_SERVING",
+			zap.Duration("drain_period", s.config.Shutdown.DrainPeriod))
+		s.health.Shutdown()
+
+		select {
+		case <-time.After(s.config.Shutdown.DrainPeriod):
+		case <-ctx.Done():
+		}
+	})
+}
+
+func (s *Server) OnStop(ctx context.Context) error {
+	s.Drain(ctx)
+
+	s.logger.Info("grpc server stopping gracefully", zap.Duration("timeout", s.stopTimeout()))
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(s.stopTimeout())
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+		s.logger.Info("grpc server stopped")
+	case <-timer.C:
+		s.logger.Warn("grpc server graceful stop timed out, closing remaining connections")
+		s.server.Stop()
+	case <-ctx.Done():
+		s.logger.Warn("grpc server shutdown cancelled, closing remaining connections")
+		s.server.Stop()
+	}
+
+	if s.reloader != nil {
+		return s.reloader.Close()
+	}
 
 	return nil
 }
 
-func NewServer(c Config, log *zap.Logger) *Server {
-	return &Server{
-		config: c,
-		server: grpc.NewServer(grpc.ChainUnaryInterceptor(grpc_zap.UnaryServerInterceptor(log))),
-		logger: log,
+func (s *Server) stopTimeout() time.Duration {
+	if s.config.Shutdown.Timeout <= 0 {
+		return defaultStopTimeout
 	}
+
+	return s.config.Shutdown.Timeout
+}
+
+func NewServer(c Config, log *zap.Logger, tp trace.TracerProvider, interceptors Interceptors) (*Server, error) {
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithTracerProvider(tp))),
+		// Recovery runs inside logging and metrics so recovered panics are
+		// recorded with their Internal code.
+		grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{
+			grpc_ctxtags.UnaryServerInterceptor(),
+			UnaryServerRequestIDInterceptor(),
+			UnaryServerMetricsInterceptor(),
+			grpc_zap.UnaryServerInterceptor(log),
+			UnaryServerRecoveryInterceptor(),
+			UnaryServerDeadlineInterceptor(c.Deadlines),
+		}, interceptors.Unary...)...),
+		grpc.ChainStreamInterceptor(append([]grpc.StreamServerInterceptor{
+			grpc_ctxtags.StreamServerInterceptor(),
+			StreamServerRequestIDInterceptor(),
+			StreamServerMetricsInterceptor(),
+			grpc_zap.StreamServerInterceptor(log),
+			StreamServerRecoveryInterceptor(),
+		}, interceptors.Stream...)...),
+	}
+
+	var reloader *certs.Reloader
+	if c.TLS.Enabled {
+		var err error
+		reloader, err = certs.NewReloader(c.TLS.CertFile, c.TLS.KeyFile, c.TLS.ClientCAFile, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificates: %v", err)
+		}
+
+		opts = append(opts, grpc.Creds(serverCredentials(c.TLS, reloader)))
+	}
+
+	server := &Server{
+		config:   c,
+		health:   healthServer,
+		reloader: reloader,
+		server:   grpc.NewServer(opts...),
+		logger:   log,
+	}
+
+	healthpb.RegisterHealthServer(server.server, healthServer)
+
+	return server, nil
+}
+
+// HealthPolicy makes the health service callable without credentials.
+func HealthPolicy() auth.Policy {
+	return auth.Policy{
+		healthpb.Health_Check_FullMethodName: {Public: true},
+		healthpb.Health_Watch_FullMethodName: {Public: true},
+	}
+}
+
+func servingStatus(serving bool) healthpb.HealthCheckResponse_ServingStatus {
+	if serving {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.Address == "" {
+		errs = append(errs, errors.New("address is required"))
+	}
+
+	if c.TLS.Enabled && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls.certFile and tls.keyFile are required when tls is enabled"))
+	}
+
+	if c.TLS.ClientCAFile == "" && (c.TLS.RequireClientCert || len(c.TLS.AllowedSANs) > 0) {
+		errs = append(errs, errors.New("tls.requireClientCert and tls.allowedSANs need tls.clientCAFile"))
+	}
+
+	if len(c.TLS.AllowedSANs) > 0 && !c.TLS.RequireClientCert {
+		errs = append(errs, errors.New("tls.allowedSANs needs tls.requireClientCert"))
+	}
+
+	if c.Deadlines.Default < 0 {
+		errs = append(errs, errors.New("deadlines.default must not be negative"))
+	}
+
+	for _, method := range c.Deadlines.Methods {
+		if !strings.HasPrefix(method.Method, "/") || method.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("deadlines.methods: %q needs a full method name and a positive timeout", method.Method))
+		}
+	}
+
+	if c.Shutdown.DrainPeriod < 0 || c.Shutdown.Timeout < 0 {
+		errs = append(errs, errors.New("shutdown durations must not be negative"))
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,145 @@
+package grpc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"net"
+	"testing"
+	"time"
+)
+
+const blockMethod = "/test.Blocking/Block"
+
+// blockingService answers Block once release is closed, or never when it is
+// nil, and reports each call on started.
+type blockingService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+var blockingServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Blocking",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Block",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+			s := srv.(*blockingService)
+			s.started <- struct{}{}
+
+			select {
+			case <-s.release:
+				return &emptypb.Empty{}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}},
+}
+
+// startServer serves service on an in-memory listener with the built-in
+// interceptors.
+func startServer(t *testing.T, config Config, log *zap.Logger, desc *grpc.ServiceDesc, service any) (*Server, *grpc.ClientConn) {
+	t.Helper()
+
+	s, err := NewServer(config, log, noop.NewTracerProvider(), Interceptors{})
+	require.NoError(t, err)
+
+	s.RegisterService(desc, service)
+	s.SetServing(true)
+
+	listener := bufconn.Listen(1 << 20)
+	s.UseListener(listener)
+	require.NoError(t, s.OnStart(context.Background()))
+	t.Cleanup(s.server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return s, conn
+}
+
+func block(conn *grpc.ClientConn) chan error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- conn.Invoke(context.Background(), blockMethod, &emptypb.Empty{}, &emptypb.Empty{})
+	}()
+
+	return done
+}
+
+func healthStatus(t *testing.T, conn *grpc.ClientConn) healthpb.HealthCheckResponse_ServingStatus {
+	response, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	return response.GetStatus()
+}
+
+func TestOnStopDrains(t *testing.T) {
+	service := &blockingService{started: make(chan struct{}, 1), release: make(chan struct{})}
+	s, conn := startServer(t, Config{Shutdown: ShutdownConfig{DrainPeriod: 200 * time.Millisecond, Timeout: 5 * time.Second}},
+		zap.NewNop(), &blockingServiceDesc, service)
+
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, healthStatus(t, conn))
+
+	call := block(conn)
+	<-service.started
+
+	stopped := make(chan error, 1)
+	start := time.Now()
+
+	go func() { stopped <- s.OnStop(context.Background()) }()
+
+	assert.Eventually(t, func() bool {
+		return healthStatus(t, conn) == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond, "health turns NOT_SERVING while the server still answers")
+
+	time.Sleep(300 * time.Millisecond)
+	close(service.release)
+
+	require.NoError(t, <-call, "the in-flight call completes")
+	require.NoError(t, <-stopped)
+	assert.Less(t, time.Since(start), 5*time.Second, "the graceful stop ends with the last call")
+
+	err := conn.Invoke(context.Background(), blockMethod, &emptypb.Empty{}, &emptypb.Empty{})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "no calls after the stop")
+}
+
+func TestOnStopCutsOffStuckCalls(t *testing.T) {
+	service := &blockingService{started: make(chan struct{}, 1)}
+	s, conn := startServer(t, Config{Shutdown: ShutdownConfig{DrainPeriod: 50 * time.Millisecond, Timeout: 200 * time.Millisecond}},
+		zap.NewNop(), &blockingServiceDesc, service)
+
+	call := block(conn)
+	<-service.started
+
+	start := time.Now()
+	require.NoError(t, s.OnStop(context.Background()))
+
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 250*time.Millisecond, "the drain period and the timeout")
+	assert.Less(t, elapsed, 2*time.Second)
+
+	select {
+	case err := <-call:
+		assert.Error(t, err, "the stuck call is cut off")
+	case <-time.After(time.Second):
+		t.Fatal("the stuck call still runs after the stop")
+	}
+}
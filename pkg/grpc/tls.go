@@ -0,0 +1,115 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/vorotilkin/twitter-users/pkg/certs"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"slices"
+)
+
+type TLSConfig struct {
+	Enabled  bool
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS: client certificates are verified
+	// against this bundle.
+	ClientCAFile      string
+	RequireClientCert bool
+	// AllowedSANs restricts client certificates to those carrying one of
+	// these DNS, URI, email or IP SANs, and needs RequireClientCert. Empty
+	// allows every verified client.
+	AllowedSANs []string
+}
+
+// ClientIdentity is the verified certificate of an mTLS client.
+type ClientIdentity struct {
+	CommonName string
+	SANs       []string
+}
+
+// ClientIdentityFromContext returns the identity of the client certificate
+// verified during the handshake of the calling connection.
+func ClientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ClientIdentity{}, false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ClientIdentity{}, false
+	}
+
+	leaf := info.State.VerifiedChains[0][0]
+
+	return ClientIdentity{
+		CommonName: leaf.Subject.CommonName,
+		SANs:       subjectAltNames(leaf),
+	}, true
+}
+
+// serverCredentials builds the tls.Config per handshake, so certificates
+// swapped by the reloader apply to new connections right away.
+func serverCredentials(c TLSConfig, reloader *certs.Reloader) credentials.TransportCredentials {
+	clientAuth := tls.NoClientCert
+	switch {
+	case c.ClientCAFile != "" && c.RequireClientCert:
+		clientAuth = tls.RequireAndVerifyClientCert
+	case c.ClientCAFile != "":
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:       tls.VersionTLS12,
+				NextProtos:       []string{"h2"},
+				GetCertificate:   reloader.Certificate,
+				ClientCAs:        reloader.CAs(),
+				ClientAuth:       clientAuth,
+				VerifyConnection: verifySANs(c.AllowedSANs),
+			}, nil
+		},
+	})
+}
+
+// verifySANs also rejects clients without a verified certificate once SANs
+// are restricted, so the restriction holds whatever ClientAuth is.
+func verifySANs(allowed []string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(allowed) == 0 {
+			return nil
+		}
+
+		if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+			return errors.New("client certificate is required")
+		}
+
+		for _, san := range subjectAltNames(state.VerifiedChains[0][0]) {
+			if slices.Contains(allowed, san) {
+				return nil
+			}
+		}
+
+		return errors.New("client certificate has no allowed SAN")
+	}
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.URIs)+len(cert.EmailAddresses)+len(cert.IPAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	return sans
+}
@@ -0,0 +1,65 @@
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestVerifySANs(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://cluster/ns/default/sa/gateway")
+	verified := func(cert *x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		allowed []string
+		state   tls.ConnectionState
+		wantErr bool
+	}{
+		{name: "unrestricted without a certificate", state: tls.ConnectionState{}},
+		{name: "unrestricted", state: verified(&x509.Certificate{DNSNames: []string{"other"}})},
+		{
+			name:    "allowed dns",
+			allowed: []string{"gateway"},
+			state:   verified(&x509.Certificate{DNSNames: []string{"gateway"}}),
+		},
+		{
+			name:    "allowed uri",
+			allowed: []string{spiffe.String()},
+			state:   verified(&x509.Certificate{URIs: []*url.URL{spiffe}}),
+		},
+		{
+			name:    "no allowed san",
+			allowed: []string{"gateway"},
+			state:   verified(&x509.Certificate{DNSNames: []string{"other"}}),
+			wantErr: true,
+		},
+		{
+			name:    "restricted without a certificate",
+			allowed: []string{"gateway"},
+			state:   tls.ConnectionState{},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySANs(tt.allowed)(tt.state)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAllowedSANsNeedRequiredClientCerts(t *testing.T) {
+	c := Config{Address: ":0", TLS: TLSConfig{Enabled: true, CertFile: "crt", KeyFile: "key", ClientCAFile: "ca", AllowedSANs: []string{"gateway"}}}
+	assert.Error(t, c.Validate())
+
+	c.TLS.RequireClientCert = true
+	assert.NoError(t, c.Validate())
+}
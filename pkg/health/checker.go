@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 2 * time.Second
+)
+
+type Config struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type StatusSetter interface {
+	SetServing(serving bool)
+}
+
+// Checker reports the service as serving once migrations are applied and
+// keeps re-checking that the database answers pings.
+type Checker struct {
+	config   Config
+	logger   *zap.Logger
+	pinger   Pinger
+	status   StatusSetter
+	migrated atomic.Bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// SetMigrated must be called once the schema is up to date. Until then the
+// service is reported as not serving regardless of the database state.
+func (c *Checker) SetMigrated() {
+	c.migrated.Store(true)
+}
+
+func (c *Checker) OnStart(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	go c.run(ctx)
+
+	return nil
+}
+
+func (c *Checker) OnStop(ctx context.Context) error {
+	c.cancel()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.status.SetServing(false)
+
+	return nil
+}
+
+func (c *Checker) run(ctx context.Context) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval())
+	defer ticker.Stop()
+
+	for {
+		c.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context) {
+	if !c.migrated.Load() {
+		c.status.SetServing(false)
+		return
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, c.timeout())
+	defer cancel()
+
+	err := c.pinger.Ping(pingCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.logger.Warn("database ping failed", zap.Error(err))
+		}
+
+		c.status.SetServing(false)
+
+		return
+	}
+
+	c.status.SetServing(true)
+}
+
+func (c *Checker) interval() time.Duration {
+	if c.config.Interval <= 0 {
+		return defaultInterval
+	}
+
+	return c.config.Interval
+}
+
+func (c *Checker) timeout() time.Duration {
+	if c.config.Timeout <= 0 {
+		return defaultTimeout
+	}
+
+	return c.config.Timeout
+}
+
+func NewChecker(c Config, log *zap.Logger, pinger Pinger, status StatusSetter) *Checker {
+	return &Checker{
+		config: c,
+		logger: log,
+		pinger: pinger,
+		status: status,
+		done:   make(chan struct{}),
+	}
+}
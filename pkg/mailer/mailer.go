@@ -0,0 +1,119 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+)
+
+const (
+	DriverLocal = "local"
+	DriverSMTP  = "smtp"
+)
+
+type Config struct {
+	Driver   string
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+func New(c Config, log *zap.Logger) (Mailer, error) {
+	switch c.Driver {
+	case DriverSMTP:
+		return NewSMTP(c), nil
+	case DriverLocal, "":
+		return NewLocal(log), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", c.Driver)
+	}
+}
+
+type SMTP struct {
+	config Config
+}
+
+func (m *SMTP) Send(_ context.Context, to, subject, body string) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.config.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(net.JoinHostPort(m.config.Host, m.config.Port), auth, m.config.From, []string{to}, []byte(msg))
+}
+
+func NewSMTP(c Config) *SMTP {
+	return &SMTP{config: c}
+}
+
+// Local keeps sent messages in memory and logs them instead of delivering.
+// It stands in for a real mail server in development and tests.
+type Local struct {
+	logger   *zap.Logger
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *Local) Send(_ context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, Message{To: to, Subject: subject, Body: body})
+	m.logger.Info("mail sent", zap.String("to", to), zap.String("subject", subject))
+
+	return nil
+}
+
+// Messages returns a copy of all messages sent so far.
+func (m *Local) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+func NewLocal(log *zap.Logger) *Local {
+	return &Local{logger: log}
+}
+
+func (c Config) Validate() error {
+	switch c.Driver {
+	case DriverLocal, "":
+		return nil
+	case DriverSMTP:
+		if c.Host == "" || c.Port == "" || c.From == "" {
+			return errors.New("host, port and from are required for the smtp driver")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown driver %q", c.Driver)
+	}
+}
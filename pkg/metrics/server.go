@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+)
+
+const defaultPath = "/metrics"
+
+type Config struct {
+	Enabled bool
+	Address string
+	Path    string
+}
+
+// Server exposes the default prometheus registry over HTTP.
+type Server struct {
+	config Config
+	logger *zap.Logger
+	server *http.Server
+}
+
+func (s *Server) OnStart(_ context.Context) error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	lis, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+
+	go func(listener net.Listener) {
+		s.logger.Info("metrics server listening on", zap.String("address", s.config.Address))
+
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("failed to serve metrics", zap.Error(err))
+		}
+	}(lis)
+
+	return nil
+}
+
+func (s *Server) OnStop(ctx context.Context) error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	return s.server.Shutdown(ctx)
+}
+
+func NewServer(c Config, log *zap.Logger) *Server {
+	path := c.Path
+	if path == "" {
+		path = defaultPath
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.Handler())
+
+	return &Server{
+		config: c,
+		logger: log,
+		server: &http.Server{Handler: mux},
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Enabled && c.Address == "" {
+		return errors.New("address is required when metrics are enabled")
+	}
+
+	return nil
+}
@@ -1,47 +1,394 @@
 package migration
 
 import (
-	"ariga.io/atlas-go-sdk/atlasexec"
 	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 	"go.uber.org/zap"
-	"os"
+	"io/fs"
+	"time"
+)
+
+// lockID keys the advisory lock held while migrating, so that instances
+// started together apply the migrations one after the other.
+const lockID int64 = 0x7477_7573_6d69_6772
+
+// operatorVersion marks the revisions written by this package. The table is
+// the one the atlas CLI uses, so either can take over from the other.
+const operatorVersion = "twitter-users"
+
+const (
+	createRevisionsQuery = `
+CREATE SCHEMA IF NOT EXISTS "atlas_schema_revisions";
+CREATE TABLE IF NOT EXISTS "atlas_schema_revisions"."atlas_schema_revisions" (
+  "version" character varying NOT NULL,
+  "description" character varying NOT NULL,
+  "type" bigint NOT NULL DEFAULT 2,
+  "applied" bigint NOT NULL DEFAULT 0,
+  "total" bigint NOT NULL DEFAULT 0,
+  "executed_at" timestamptz NOT NULL,
+  "execution_time" bigint NOT NULL,
+  "error" text NULL,
+  "error_stmt" text NULL,
+  "hash" character varying NOT NULL,
+  "partial_hashes" jsonb NULL,
+  "operator_version" character varying NOT NULL,
+  PRIMARY KEY ("version")
+)`
+	revisionsExistQuery = `SELECT to_regclass('"atlas_schema_revisions"."atlas_schema_revisions"') IS NOT NULL`
+	// Versions starting with a dot hold atlas metadata, not migrations.
+	selectRevisionsQuery = `
+SELECT "version", "executed_at", "error"
+FROM "atlas_schema_revisions"."atlas_schema_revisions"
+WHERE "version" NOT LIKE '.%'`
+	insertRevisionQuery = `
+INSERT INTO "atlas_schema_revisions"."atlas_schema_revisions"
+  ("version", "description", "type", "applied", "total", "executed_at", "execution_time", "hash", "operator_version")
+VALUES ($1, $2, 2, 1, 1, $3, $4, $5, $6)`
+	deleteRevisionQuery = `DELETE FROM "atlas_schema_revisions"."atlas_schema_revisions" WHERE "version" = $1`
 )
 
 type Config struct {
-	Path          string
 	NeedMigration bool
+	// LockTimeout bounds the wait for another instance that is migrating.
+	LockTimeout time.Duration
+	// Path is deprecated and ignored: the migrations are built into the
+	// binary. It is still accepted so that older config files load.
+	Path string
 }
 
-func Do(logger *zap.Logger, migrationConfig Config, dbConnStr string) error {
-	if !migrationConfig.NeedMigration {
+// warnDeprecated logs the settings that are accepted but ignored.
+func (c Config) warnDeprecated(logger *zap.Logger) {
+	if c.Path != "" {
+		logger.Warn("migration.path is deprecated and ignored, the migrations are built into the binary",
+			zap.String("path", c.Path))
+	}
+}
+
+func (c Config) Validate() error {
+	if c.LockTimeout < 0 {
+		return errors.New("lockTimeout must not be negative")
+	}
+
+	return nil
+}
+
+// Status is a migration together with when it was applied, zero when it is
+// pending.
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Migrator applies and reverts migrations on one connection, which holds the
+// advisory lock for the whole run.
+type Migrator struct {
+	config     Config
+	logger     *zap.Logger
+	dsn        string
+	migrations []Migration
+}
+
+// Up applies every pending migration, each in its own transaction.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(ctx, func(conn *pgx.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if !status.AppliedAt.IsZero() {
+				continue
+			}
+
+			err = m.apply(ctx, conn, status.Migration)
+			if err != nil {
+				return err
+			}
+
+			applied = append(applied, status.Migration)
+		}
+
 		return nil
+	})
+
+	return applied, err
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *pgx.Conn, migration Migration) error {
+	start := time.Now()
+
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, migration.Up)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, insertRevisionQuery,
+			migration.Version,
+			migration.Description,
+			start,
+			time.Since(start).Nanoseconds(),
+			migration.Hash,
+			operatorVersion,
+		)
+
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "apply %s_%s", migration.Version, migration.Description)
 	}
 
-	workdir, err := atlasexec.NewWorkingDir(
-		atlasexec.WithMigrations(
-			os.DirFS(migrationConfig.Path),
-		),
-	)
+	m.logger.Info("migration applied",
+		zap.String("version", migration.Version),
+		zap.String("description", migration.Description),
+		zap.Duration("took", time.Since(start)))
+
+	return nil
+}
+
+// Down reverts the last n applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.locked(ctx, func(conn *pgx.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && len(reverted) < n; i-- {
+			if statuses[i].AppliedAt.IsZero() {
+				continue
+			}
+
+			err = m.revert(ctx, conn, statuses[i].Migration)
+			if err != nil {
+				return err
+			}
+
+			reverted = append(reverted, statuses[i].Migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *pgx.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return errors.Errorf("%s_%s has no down migration", migration.Version, migration.Description)
+	}
+
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, migration.Down)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, deleteRevisionQuery, migration.Version)
+
+		return err
+	})
 	if err != nil {
-		return errors.Wrap(err, "failed to load working directory")
+		return errors.Wrapf(err, "revert %s_%s", migration.Version, migration.Description)
 	}
 
-	defer workdir.Close()
+	m.logger.Info("migration reverted",
+		zap.String("version", migration.Version),
+		zap.String("description", migration.Description))
+
+	return nil
+}
+
+// Status lists every migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
 
-	client, err := atlasexec.NewClient(workdir.Path(), "atlas")
+	err := m.connect(ctx, func(conn *pgx.Conn) error {
+		var err error
+		statuses, err = m.status(ctx, conn)
+
+		return err
+	})
+
+	return statuses, err
+}
+
+// Pending lists the migrations Up would apply, without applying them.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize client")
+		return nil, err
 	}
 
-	res, err := client.MigrateApply(context.Background(), &atlasexec.MigrateApplyParams{
-		URL: dbConnStr,
+	var pending []Migration
+
+	for _, status := range statuses {
+		if status.AppliedAt.IsZero() {
+			pending = append(pending, status.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) status(ctx context.Context, conn *pgx.Conn) ([]Status, error) {
+	var exists bool
+
+	err := conn.QueryRow(ctx, revisionsExistQuery).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return lo.Map(m.migrations, func(migration Migration, _ int) Status {
+			return Status{Migration: migration}
+		}), nil
+	}
+
+	rows, err := conn.Query(ctx, selectRevisionsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	type revision struct {
+		Version    string
+		ExecutedAt time.Time
+		Error      *string
+	}
+
+	revisions, err := pgx.CollectRows(rows, pgx.RowToStructByPos[revision])
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[string]time.Time, len(revisions))
+
+	for _, r := range revisions {
+		// Only the atlas CLI leaves a failed revision behind.
+		if r.Error != nil && *r.Error != "" {
+			return nil, errors.Errorf("migration %s failed partway through and needs manual repair: %s", r.Version, *r.Error)
+		}
+
+		appliedAt[r.Version] = r.ExecutedAt
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{Migration: migration, AppliedAt: appliedAt[migration.Version]})
+		delete(appliedAt, migration.Version)
+	}
+
+	// A newer build may have migrated already during a rolling deploy.
+	for version := range appliedAt {
+		m.logger.Warn("applied migration is unknown to this build", zap.String("version", version))
+	}
+
+	return statuses, nil
+}
+
+// locked runs fn while holding the advisory lock, after making sure the
+// revisions table exists.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	return m.connect(ctx, func(conn *pgx.Conn) error {
+		lockCtx := ctx
+		if m.config.LockTimeout > 0 {
+			var cancel context.CancelFunc
+			lockCtx, cancel = context.WithTimeout(ctx, m.config.LockTimeout)
+			defer cancel()
+		}
+
+		_, err := conn.Exec(lockCtx, "SELECT pg_advisory_lock($1)", lockID)
+		if err != nil {
+			return errors.Wrap(err, "acquire migration lock")
+		}
+
+		defer func() { _, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID) }()
+
+		_, err = conn.Exec(ctx, createRevisionsQuery)
+		if err != nil {
+			return err
+		}
+
+		return fn(conn)
 	})
+}
+
+func (m *Migrator) connect(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	config, err := connConfig(m.dsn)
+	if err != nil {
+		return err
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	if err != nil {
+		return errors.Wrap(err, "connect")
+	}
+
+	defer func() { _ = conn.Close(context.Background()) }()
+
+	return fn(conn)
+}
+
+// connConfig parses dsn as the service pool does, so that the pool settings
+// it may carry are not sent to the server as unknown parameters.
+func connConfig(dsn string) (*pgx.ConnConfig, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse dsn")
+	}
+
+	return config.ConnConfig, nil
+}
+
+// New loads the migrations from fsys, laid out as schema/migrations.
+func New(config Config, logger *zap.Logger, dsn string, fsys fs.FS) (*Migrator, error) {
+	config.warnDeprecated(logger)
+
+	return newMigrator(config, logger, dsn, fsys)
+}
+
+func newMigrator(config Config, logger *zap.Logger, dsn string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		config:     config,
+		logger:     logger,
+		dsn:        dsn,
+		migrations: migrations,
+	}, nil
+}
+
+// Do applies the pending migrations on startup when NeedMigration is set.
+func Do(logger *zap.Logger, migrationConfig Config, dbConnStr string, fsys fs.FS) error {
+	migrationConfig.warnDeprecated(logger)
+
+	if !migrationConfig.NeedMigration {
+		return nil
+	}
+
+	migrator, err := newMigrator(migrationConfig, logger, dbConnStr, fsys)
+	if err != nil {
+		return errors.Wrap(err, "failed to load migrations")
+	}
+
+	applied, err := migrator.Up(context.Background())
 	if err != nil {
 		return errors.Wrap(err, "failed to apply migrations")
 	}
 
-	logger.Info("success migrations applied", zap.Any("applied files", res.Applied))
+	logger.Info("success migrations applied", zap.Int("applied files", len(applied)))
 
 	return nil
 }
@@ -0,0 +1,16 @@
+package migration
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestConnConfigDropsPoolSettings(t *testing.T) {
+	config, err := connConfig("postgres://user@localhost:5432/users?pool_max_conns=4&pool_min_conns=1&pool_max_conn_lifetime=1h&application_name=users")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"application_name": "users"}, config.RuntimeParams,
+		"only real server parameters reach the startup message")
+	assert.Equal(t, "users", config.Database)
+}
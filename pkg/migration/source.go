@@ -0,0 +1,143 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	sumFile   = "atlas.sum"
+	downDir   = "down"
+	hashAlgo  = "h1:"
+	sqlSuffix = ".sql"
+)
+
+// Migration is one versioned file of the migration directory.
+type Migration struct {
+	// Version is the numeric prefix of the file name, Description the rest.
+	Version     string
+	Description string
+	Up          string
+	// Down reverts Up. It is empty when the migration cannot be reverted.
+	Down string
+	// Hash is the entry of the file in atlas.sum.
+	Hash string
+}
+
+// Load reads the migrations at the root of fsys in version order and checks
+// them against atlas.sum, so that a file edited after the sum was computed
+// is never applied.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*"+sqlSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+
+	sums, err := readSum(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	hash := sha256.New()
+	total := sha256.New()
+
+	// Like atlas, every file hash covers the files before it, so a file
+	// removed or reordered changes all the hashes that follow.
+	for _, name := range names {
+		up, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		hash.Write([]byte(name))
+		hash.Write(up)
+
+		fileHash := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+		if sums.files[name] != fileHash {
+			return nil, errors.Errorf("%s does not match %s, recompute it with atlas migrate hash", name, sumFile)
+		}
+
+		total.Write([]byte(name))
+		total.Write([]byte(fileHash))
+
+		down, err := fs.ReadFile(fsys, path.Join(downDir, name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		version, description, _ := strings.Cut(strings.TrimSuffix(name, sqlSuffix), "_")
+		migrations = append(migrations, Migration{
+			Version:     version,
+			Description: description,
+			Up:          string(up),
+			Down:        string(down),
+			Hash:        fileHash,
+		})
+	}
+
+	if len(sums.files) != len(names) || sums.total != base64.StdEncoding.EncodeToString(total.Sum(nil)) {
+		return nil, errors.Errorf("%s does not match the migration files, recompute it with atlas migrate hash", sumFile)
+	}
+
+	downs, err := fs.Glob(fsys, path.Join(downDir, "*"+sqlSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	// A down file whose name drifted from its migration would never run.
+	for _, down := range downs {
+		if _, ok := sums.files[path.Base(down)]; !ok {
+			return nil, errors.Errorf("%s has no migration to revert", down)
+		}
+	}
+
+	return migrations, nil
+}
+
+type sum struct {
+	total string
+	files map[string]string
+}
+
+// readSum parses atlas.sum: the hash of the whole directory on the first
+// line, then one "name hash" line per file.
+func readSum(fsys fs.FS) (sum, error) {
+	content, err := fs.ReadFile(fsys, sumFile)
+	if err != nil {
+		return sum{}, errors.Wrapf(err, "read %s", sumFile)
+	}
+
+	s := sum{files: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		if s.total == "" {
+			s.total = strings.TrimPrefix(line, hashAlgo)
+			continue
+		}
+
+		name, hash, ok := strings.Cut(line, " ")
+		if !ok || !strings.HasPrefix(hash, hashAlgo) {
+			return sum{}, errors.Errorf("malformed %s line %q", sumFile, line)
+		}
+
+		s.files[name] = strings.TrimPrefix(hash, hashAlgo)
+	}
+
+	return s, scanner.Err()
+}
@@ -0,0 +1,141 @@
+package migration_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/pkg/migration"
+	"github.com/vorotilkin/twitter-users/schema/migrations"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// sum computes atlas.sum for files the way atlas migrate hash does.
+func sum(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var lines []string
+
+	hash := sha256.New()
+	total := sha256.New()
+
+	for _, name := range names {
+		hash.Write([]byte(name))
+		hash.Write([]byte(files[name]))
+
+		fileHash := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+		lines = append(lines, name+" h1:"+fileHash)
+
+		total.Write([]byte(name))
+		total.Write([]byte(fileHash))
+	}
+
+	return "h1:" + base64.StdEncoding.EncodeToString(total.Sum(nil)) + "\n" + strings.Join(lines, "\n") + "\n"
+}
+
+var files = map[string]string{
+	"20240101000000_users.sql":  "CREATE TABLE users (id int);\n",
+	"20240102000000_emails.sql": "ALTER TABLE users ADD email text;\n",
+}
+
+func newFS() fstest.MapFS {
+	fsys := fstest.MapFS{"atlas.sum": {Data: []byte(sum(files))}}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+
+	fsys["down/20240102000000_emails.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE users DROP email;\n")}
+
+	return fsys
+}
+
+func TestLoad(t *testing.T) {
+	loaded, err := migration.Load(newFS())
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+
+	assert.Equal(t, "20240101000000", loaded[0].Version)
+	assert.Equal(t, "users", loaded[0].Description)
+	assert.Equal(t, files["20240101000000_users.sql"], loaded[0].Up)
+	assert.Empty(t, loaded[0].Down, "no down file, cannot be reverted")
+
+	assert.Equal(t, "emails", loaded[1].Description)
+	assert.Equal(t, "ALTER TABLE users DROP email;\n", loaded[1].Down)
+	assert.NotEqual(t, loaded[0].Hash, loaded[1].Hash)
+}
+
+func TestLoadShippedMigrations(t *testing.T) {
+	loaded, err := migration.Load(migrations.FS)
+	require.NoError(t, err, "atlas.sum written by atlas verifies")
+
+	for _, m := range loaded {
+		assert.NotEmpty(t, m.Down, m.Version)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		change func(fsys fstest.MapFS)
+	}{
+		{
+			name:   "tampered file",
+			change: func(fsys fstest.MapFS) { fsys["20240101000000_users.sql"].Data = []byte("DROP TABLE users;\n") },
+		},
+		{
+			name:   "missing sum",
+			change: func(fsys fstest.MapFS) { delete(fsys, "atlas.sum") },
+		},
+		{
+			name:   "missing file",
+			change: func(fsys fstest.MapFS) { delete(fsys, "20240102000000_emails.sql") },
+		},
+		{
+			name: "file missing from the sum",
+			change: func(fsys fstest.MapFS) {
+				fsys["20240103000000_extra.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;\n")}
+			},
+		},
+		{
+			name: "file added to the sum only",
+			change: func(fsys fstest.MapFS) {
+				fsys["atlas.sum"].Data = append(fsys["atlas.sum"].Data, "20240103000000_extra.sql h1:AAAA\n"...)
+			},
+		},
+		{
+			name: "tampered total",
+			change: func(fsys fstest.MapFS) {
+				lines := strings.SplitN(string(fsys["atlas.sum"].Data), "\n", 2)
+				fsys["atlas.sum"].Data = []byte("h1:AAAA\n" + lines[1])
+			},
+		},
+		{
+			name: "malformed sum",
+			change: func(fsys fstest.MapFS) {
+				fsys["atlas.sum"].Data = append(fsys["atlas.sum"].Data, "garbage\n"...)
+			},
+		},
+		{
+			name: "down file without a migration",
+			change: func(fsys fstest.MapFS) {
+				fsys["down/20240102000000_email.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;\n")}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newFS()
+			tt.change(fsys)
+
+			_, err := migration.Load(fsys)
+			assert.Error(t, err)
+		})
+	}
+}
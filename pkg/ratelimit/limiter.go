@@ -0,0 +1,280 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vorotilkin/twitter-users/pkg/auth"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/pkg/gateway"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// KeyCaller limits the authenticated caller, falling back to the peer IP
+	// for anonymous calls.
+	KeyCaller = "caller"
+	// KeyIP limits the peer IP, or the HTTP client of calls proxied by the
+	// in-process gateway.
+	KeyIP = "ip"
+	// KeyUser limits the user_id field of the request, falling back to the
+	// caller for requests without one.
+	KeyUser = "user"
+
+	defaultSweepInterval = time.Minute
+)
+
+type Config struct {
+	Enabled       bool
+	Store         string
+	SweepInterval time.Duration
+	// TrustForwardedFor keys IP limits by the first X-Forwarded-For address,
+	// for a proxy in front of the service that overwrites the header. Enable
+	// it only when clients cannot bypass that proxy, otherwise they can pick
+	// their own key.
+	TrustForwardedFor bool
+	Limits            []Limit
+}
+
+// Limit is a token bucket of Burst tokens refilled at Rate tokens per second.
+type Limit struct {
+	Method string
+	Key    string
+	Rate   float64
+	Burst  int
+}
+
+// Limiter rejects calls exceeding the configured limits with ResourceExhausted.
+type Limiter struct {
+	config Config
+	logger *zap.Logger
+	store  Store
+	// gateway vouches for the client IP of the calls it proxies.
+	gateway gateway.Secret
+	limits  atomic.Pointer[map[string][]Limit]
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		for _, limit := range (*l.limits.Load())[info.FullMethod] {
+			err := l.take(ctx, info.FullMethod, limit, req)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// take fails open: an unavailable store must not take the service down.
+func (l *Limiter) take(ctx context.Context, method string, limit Limit, req any) error {
+	key := method + "|" + l.key(ctx, limit.Key, req)
+
+	allowed, retryAfter, err := l.store.Take(ctx, key, limit.Rate, limit.Burst)
+	if err != nil {
+		requestid.Logger(ctx, l.logger).Warn("failed to check rate limit", zap.String("method", method), zap.Error(err))
+		return nil
+	}
+
+	if allowed {
+		return nil
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))))
+
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+
+	return st.Err()
+}
+
+func (l *Limiter) key(ctx context.Context, kind string, req any) string {
+	switch kind {
+	case KeyUser:
+		if r, ok := req.(interface{ GetUserId() int32 }); ok {
+			return "user:" + strconv.Itoa(int(r.GetUserId()))
+		}
+
+		return l.key(ctx, KeyCaller, req)
+	case KeyCaller:
+		identity, ok := auth.FromContext(ctx)
+		if !ok {
+			return l.key(ctx, KeyIP, req)
+		}
+
+		if identity.IsService() {
+			return "service:" + identity.Service
+		}
+
+		return "user:" + strconv.Itoa(int(identity.UserID))
+	default:
+		return "ip:" + l.peerIP(ctx)
+	}
+}
+
+func (l *Limiter) peerIP(ctx context.Context) string {
+	if l.config.TrustForwardedFor {
+		forwarded := metadata.ValueFromIncomingContext(ctx, "x-forwarded-for")
+		if len(forwarded) > 0 {
+			ip, _, _ := strings.Cut(forwarded[0], ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+
+	ip, ok := l.gateway.ClientIP(ctx)
+	if ok {
+		return ip
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func (l *Limiter) OnStart(_ context.Context) error {
+	if !l.config.Enabled {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.done = make(chan struct{})
+
+	go l.sweep(ctx)
+
+	return nil
+}
+
+func (l *Limiter) OnStop(ctx context.Context) error {
+	if l.cancel == nil {
+		return nil
+	}
+
+	l.cancel()
+
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) sweep(ctx context.Context) {
+	defer close(l.done)
+
+	interval := l.config.SweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := l.store.Sweep(ctx)
+			if err != nil {
+				l.logger.Error("failed to sweep rate limit buckets", zap.Error(err))
+			}
+		}
+	}
+}
+
+// SetLimits replaces the limits without a restart. Buckets are kept, so a
+// changed limit applies to the tokens already taken.
+func (l *Limiter) SetLimits(limits []Limit) error {
+	err := validateLimits(limits)
+	if err != nil {
+		return err
+	}
+
+	byMethod := make(map[string][]Limit)
+	if l.config.Enabled {
+		for _, limit := range limits {
+			byMethod[limit.Method] = append(byMethod[limit.Method], limit)
+		}
+	}
+
+	l.limits.Store(&byMethod)
+
+	return nil
+}
+
+func (c Config) Validate() error {
+	switch c.Store {
+	case StoreMemory, StorePostgres, "":
+	default:
+		return fmt.Errorf("unknown store %q", c.Store)
+	}
+
+	return validateLimits(c.Limits)
+}
+
+func validateLimits(limits []Limit) error {
+	var errs []error
+	for _, limit := range limits {
+		switch {
+		case !strings.HasPrefix(limit.Method, "/"):
+			errs = append(errs, fmt.Errorf("limits: %q is not a full method name", limit.Method))
+		case limit.Key != KeyCaller && limit.Key != KeyIP && limit.Key != KeyUser:
+			errs = append(errs, fmt.Errorf("limits: unknown key %q for %s", limit.Key, limit.Method))
+		case limit.Rate <= 0 || limit.Burst < 1:
+			errs = append(errs, fmt.Errorf("limits: %s needs a positive rate and burst", limit.Method))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func New(c Config, log *zap.Logger, db *database.Database, secret gateway.Secret) (*Limiter, error) {
+	store, err := newStore(c, db)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Limiter{
+		config:  c,
+		logger:  log,
+		store:   store,
+		gateway: secret,
+	}
+
+	err = l.SetLimits(c.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/pkg/auth"
+	"github.com/vorotilkin/twitter-users/pkg/gateway"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"testing"
+)
+
+const method = "/users.Users/Follow"
+
+type followRequest struct{ userID int32 }
+
+func (r followRequest) GetUserId() int32 { return r.userID }
+
+func call(ctx context.Context, limiter *Limiter, req any) error {
+	_, err := limiter.UnaryServerInterceptor()(ctx, req, &grpc.UnaryServerInfo{FullMethod: method},
+		func(context.Context, any) (any, error) { return nil, nil })
+
+	return err
+}
+
+func fromPeer(ip string, md ...string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}})
+
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(md...))
+}
+
+func newLimiter(t *testing.T, config Config, secret gateway.Secret) *Limiter {
+	t.Helper()
+
+	config.Enabled = true
+	limiter, err := New(config, zap.NewNop(), nil, secret)
+	require.NoError(t, err)
+
+	return limiter
+}
+
+func TestLimiterRejectsWithRetryInfo(t *testing.T) {
+	limiter := newLimiter(t, Config{Limits: []Limit{{Method: method, Key: KeyIP, Rate: 1, Burst: 1}}}, "")
+	ctx := fromPeer("10.0.0.1")
+
+	require.NoError(t, call(ctx, limiter, nil))
+
+	err := call(ctx, limiter, nil)
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	details := status.Convert(err).Details()
+	require.Len(t, details, 1)
+	assert.Positive(t, details[0].(*errdetails.RetryInfo).GetRetryDelay().AsDuration())
+
+	assert.NoError(t, call(fromPeer("10.0.0.2"), limiter, nil), "other peers have their own bucket")
+}
+
+func TestLimiterKeys(t *testing.T) {
+	secret, err := gateway.NewSecret()
+	require.NoError(t, err)
+
+	alice := auth.WithIdentity(fromPeer("10.0.0.1"), auth.Identity{UserID: 1})
+
+	for _, tt := range []struct {
+		name         string
+		key          string
+		trustForward bool
+		first, other context.Context
+		req          any
+		shared       bool
+	}{
+		{
+			name:  "peers",
+			key:   KeyIP,
+			first: fromPeer("10.0.0.1"),
+			other: fromPeer("10.0.0.2"),
+		},
+		{
+			name:  "gateway clients",
+			key:   KeyIP,
+			first: fromPeer("127.0.0.1", "x-gateway-client-ip", "203.0.113.1", "x-gateway-secret", string(secret)),
+			other: fromPeer("127.0.0.1", "x-gateway-client-ip", "203.0.113.2", "x-gateway-secret", string(secret)),
+		},
+		{
+			name:   "forged gateway clients",
+			key:    KeyIP,
+			first:  fromPeer("10.0.0.1", "x-gateway-client-ip", "203.0.113.1", "x-gateway-secret", "guess"),
+			other:  fromPeer("10.0.0.1", "x-gateway-client-ip", "203.0.113.2", "x-gateway-secret", "guess"),
+			shared: true,
+		},
+		{
+			name:   "untrusted forwarded for",
+			key:    KeyIP,
+			first:  fromPeer("10.0.0.1", "x-forwarded-for", "203.0.113.1"),
+			other:  fromPeer("10.0.0.1", "x-forwarded-for", "203.0.113.2"),
+			shared: true,
+		},
+		{
+			name:         "trusted forwarded for",
+			key:          KeyIP,
+			trustForward: true,
+			first:        fromPeer("10.0.0.1", "x-forwarded-for", "203.0.113.1, 10.0.0.1"),
+			other:        fromPeer("10.0.0.1", "x-forwarded-for", "203.0.113.2, 10.0.0.1"),
+		},
+		{
+			name:  "callers",
+			key:   KeyCaller,
+			first: alice,
+			other: auth.WithIdentity(fromPeer("10.0.0.1"), auth.Identity{UserID: 2}),
+		},
+		{
+			name:  "anonymous callers by ip",
+			key:   KeyCaller,
+			first: fromPeer("10.0.0.1"),
+			other: alice,
+		},
+		{
+			name:   "user of the request",
+			key:    KeyUser,
+			first:  alice,
+			other:  auth.WithIdentity(fromPeer("10.0.0.2"), auth.Identity{UserID: 2}),
+			req:    followRequest{userID: 7},
+			shared: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newLimiter(t, Config{
+				TrustForwardedFor: tt.trustForward,
+				Limits:            []Limit{{Method: method, Key: tt.key, Rate: 0.001, Burst: 1}},
+			}, secret)
+
+			require.NoError(t, call(tt.first, limiter, tt.req))
+
+			err := call(tt.other, limiter, tt.req)
+			if tt.shared {
+				assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
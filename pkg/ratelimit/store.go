@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// Store keeps token buckets. Take consumes a token from the bucket under key
+// and, when the bucket is empty, reports how long until the next token.
+type Store interface {
+	Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error)
+	// Sweep drops buckets that have refilled completely, since a missing
+	// bucket behaves like a full one.
+	Sweep(ctx context.Context) (int64, error)
+}
+
+func newStore(c Config, db *database.Database) (Store, error) {
+	switch c.Store {
+	case StoreMemory, "":
+		return NewMemory(), nil
+	case StorePostgres:
+		return NewPostgres(db), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", c.Store)
+	}
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	expiresAt time.Time
+}
+
+// Memory keeps buckets in process, so every instance enforces its own limits.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func (m *Memory) Take(_ context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updatedAt: now}
+		m.buckets[key] = b
+	}
+
+	tokens := math.Min(float64(burst), b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	if tokens < 1 {
+		return false, seconds((1 - tokens) / rate), nil
+	}
+
+	b.tokens = tokens - 1
+	b.updatedAt = now
+	b.expiresAt = now.Add(seconds((float64(burst) - b.tokens) / rate))
+
+	return true, 0, nil
+}
+
+func (m *Memory) Sweep(context.Context) (int64, error) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for key, b := range m.buckets {
+		if b.expiresAt.Before(now) {
+			delete(m.buckets, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// refill is the number of tokens in the bucket at the start of the
+// statement, capped at the burst.
+const refill = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM LOCALTIMESTAMP - b.updated_at)::float8 * $3::float8)`
+
+// takeQuery leaves an empty bucket untouched, so updated_at only equals the
+// statement timestamp when a token was taken.
+const takeQuery = `INSERT INTO rate_limit_bucket AS b (key, tokens, updated_at, expires_at)
+VALUES ($1, $2::float8 - 1, LOCALTIMESTAMP, LOCALTIMESTAMP + make_interval(secs => 1 / $3::float8))
+ON CONFLICT (key) DO UPDATE SET
+	tokens = CASE WHEN ` + refill + ` >= 1 THEN ` + refill + ` - 1 ELSE b.tokens END,
+	updated_at = CASE WHEN ` + refill + ` >= 1 THEN LOCALTIMESTAMP ELSE b.updated_at END,
+	expires_at = CASE WHEN ` + refill + ` >= 1
+		THEN LOCALTIMESTAMP + make_interval(secs => ($2::float8 - ` + refill + ` + 1) / $3::float8)
+		ELSE b.expires_at END
+RETURNING b.updated_at = LOCALTIMESTAMP, (1 - ` + refill + `) / $3::float8`
+
+const sweepQuery = `DELETE FROM rate_limit_bucket WHERE expires_at < LOCALTIMESTAMP`
+
+// Postgres shares buckets between instances. Every Take is a single upsert,
+// so concurrent callers serialize on the bucket row.
+type Postgres struct {
+	db *database.Database
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	ctx = database.WithQueryName(ctx, "ratelimit.Take")
+
+	var (
+		allowed bool
+		retry   float64
+	)
+
+	err := p.db.QueryRow(ctx, takeQuery, key, float64(burst), rate).Scan(&allowed, &retry)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if allowed {
+		return true, 0, nil
+	}
+
+	return false, seconds(retry), nil
+}
+
+func (p *Postgres) Sweep(ctx context.Context) (int64, error) {
+	ctx = database.WithQueryName(ctx, "ratelimit.Sweep")
+
+	tag, err := p.db.Exec(ctx, sweepQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func NewPostgres(db *database.Database) *Postgres {
+	return &Postgres{db: db}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/pkg/database/dbtest"
+	"testing"
+	"time"
+)
+
+// newClockedMemory returns a memory store whose clock only moves with the
+// returned advance.
+func newClockedMemory() (*Memory, func(time.Duration)) {
+	now := time.Date(2024, 12, 26, 0, 0, 0, 0, time.UTC)
+
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryTake(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newClockedMemory()
+
+	take := func() (bool, time.Duration) {
+		allowed, retryAfter, err := m.Take(ctx, "key", 2, 3)
+		require.NoError(t, err)
+
+		return allowed, retryAfter
+	}
+
+	for range 3 {
+		allowed, _ := take()
+		require.True(t, allowed, "a new bucket holds the burst")
+	}
+
+	allowed, retryAfter := take()
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter, "one token at two per second")
+
+	advance(200 * time.Millisecond)
+
+	allowed, retryAfter = take()
+	assert.False(t, allowed)
+	assert.Equal(t, 300*time.Millisecond, retryAfter, "a rejected take does not reset the refill")
+
+	advance(300 * time.Millisecond)
+
+	allowed, _ = take()
+	assert.True(t, allowed)
+
+	advance(time.Hour)
+
+	for range 3 {
+		allowed, _ = take()
+		assert.True(t, allowed)
+	}
+
+	allowed, _ = take()
+	assert.False(t, allowed, "the refill is capped at the burst")
+
+	allowed, _, err := m.Take(ctx, "other", 2, 3)
+	require.NoError(t, err)
+	assert.True(t, allowed, "keys have their own buckets")
+}
+
+func TestMemorySweep(t *testing.T) {
+	ctx := context.Background()
+	m, advance := newClockedMemory()
+
+	_, _, err := m.Take(ctx, "slow", 1, 2)
+	require.NoError(t, err)
+	_, _, err = m.Take(ctx, "fast", 10, 2)
+	require.NoError(t, err)
+
+	advance(500 * time.Millisecond)
+
+	deleted, err := m.Sweep(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted, "only the fast bucket has refilled")
+
+	advance(time.Second)
+
+	deleted, err = m.Sweep(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+	assert.Empty(t, m.buckets)
+}
+
+func TestPostgres(t *testing.T) {
+	ctx := context.Background()
+
+	db := dbtest.New(t)
+	dbtest.Truncate(t, db, "rate_limit_bucket")
+
+	p := NewPostgres(db)
+
+	t.Run("take", func(t *testing.T) {
+		for range 2 {
+			allowed, _, err := p.Take(ctx, "take", 0.01, 2)
+			require.NoError(t, err)
+			require.True(t, allowed)
+		}
+
+		allowed, retryAfter, err := p.Take(ctx, "take", 0.01, 2)
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.InDelta(t, 100*time.Second, retryAfter, float64(time.Second))
+
+		allowed, _, err = p.Take(ctx, "take-other", 0.01, 2)
+		require.NoError(t, err)
+		assert.True(t, allowed, "keys have their own buckets")
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		allowed, _, err := p.Take(ctx, "refill", 100, 1)
+		require.NoError(t, err)
+		require.True(t, allowed)
+
+		time.Sleep(20 * time.Millisecond)
+
+		allowed, _, err = p.Take(ctx, "refill", 100, 1)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("sweep", func(t *testing.T) {
+		_, _, err := p.Take(ctx, "sweep", 1000, 1)
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = p.Sweep(ctx)
+		require.NoError(t, err)
+
+		var left int
+		err = db.QueryRow(ctx, `SELECT count(*) FROM rate_limit_bucket WHERE key = 'sweep'`).Scan(&left)
+		require.NoError(t, err)
+		assert.Zero(t, left)
+	})
+}
@@ -0,0 +1,58 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go.uber.org/zap"
+)
+
+// MetadataKey carries the request ID in gRPC metadata and, as X-Request-Id,
+// in HTTP headers.
+const MetadataKey = "x-request-id"
+
+const maxLength = 128
+
+type contextKey struct{}
+
+func New() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Valid rejects IDs that would pollute logs: empty, overly long or containing
+// anything but printable ASCII.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// Logger returns log annotated with the request ID of ctx, if any.
+func Logger(ctx context.Context, log *zap.Logger) *zap.Logger {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return log
+	}
+
+	return log.With(zap.String("request_id", id))
+}
@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"github.com/vorotilkin/twitter-users/pkg/migration"
+	"go.uber.org/zap"
+	"io/fs"
+	"time"
+)
+
+const (
+	createRevisionsQuery = `
+CREATE TABLE IF NOT EXISTS "schema_revisions" (
+  "version" text NOT NULL PRIMARY KEY,
+  "description" text NOT NULL,
+  "hash" text NOT NULL,
+  "executed_at" timestamp NOT NULL
+)`
+	selectRevisionsQuery = `SELECT "version" FROM "schema_revisions"`
+	insertRevisionQuery  = `
+INSERT INTO "schema_revisions" ("version", "description", "hash", "executed_at")
+VALUES (?, ?, ?, ?)`
+)
+
+// Migrate applies the pending migrations of fsys, laid out as for
+// migration.Load, each in its own transaction.
+func Migrate(ctx context.Context, db *DB, logger *zap.Logger, fsys fs.FS) error {
+	migrations, err := migration.Load(fsys)
+	if err != nil {
+		return errors.Wrap(err, "load migrations")
+	}
+
+	_, err = db.ExecContext(ctx, createRevisionsQuery)
+	if err != nil {
+		return errors.Wrap(err, "create revisions table")
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return errors.Wrap(err, "read revisions")
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		err = db.InTx(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, m.Up)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.ExecContext(ctx, insertRevisionQuery, m.Version, m.Description, m.Hash, time.Now().UTC())
+
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "apply %s_%s", m.Version, m.Description)
+		}
+
+		logger.Info("migration applied", zap.String("version", m.Version), zap.String("description", m.Description))
+	}
+
+	return nil
+}
+
+func appliedVersions(ctx context.Context, db *DB) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, selectRevisionsQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[string]bool)
+
+	for rows.Next() {
+		var version string
+
+		err = rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
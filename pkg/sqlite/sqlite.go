@@ -0,0 +1,94 @@
+// Package sqlite opens an embedded SQLite database, which stands in for
+// Postgres when developing or testing without a database server.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"net/url"
+)
+
+// MemoryPath keeps the database in memory, so it is gone when the process
+// exits.
+const MemoryPath = ":memory:"
+
+type Config struct {
+	// Path is the database file, created when missing, or MemoryPath.
+	Path string
+}
+
+func (c Config) Validate() error {
+	if c.Path == "" {
+		return errors.New("path is required")
+	}
+
+	return nil
+}
+
+// DB is a database/sql handle holding a single connection. SQLite allows one
+// writer at a time anyway, and a single connection keeps an in-memory
+// database shared by every query.
+type DB struct {
+	*sql.DB
+}
+
+// Ping reports whether the database answers, for the health checks.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
+// InTx runs fn inside a transaction, committing when fn returns nil and
+// rolling back otherwise. fn must only use tx, as the only connection is busy
+// with it.
+func (db *DB) InTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsUniqueViolation reports whether err was caused by a unique index or
+// primary key.
+func IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE ||
+		sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+func Open(config Config) (*DB, error) {
+	// Foreign keys are off by default in SQLite. The sqlite time format
+	// keeps stored timestamps comparable as text.
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Set("_time_format", "sqlite")
+
+	conn, err := sql.Open("sqlite", fmt.Sprintf("file:%s?%s", config.Path, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetMaxOpenConns(1)
+	// An in-memory database lives as long as its connection.
+	conn.SetConnMaxIdleTime(0)
+	conn.SetConnMaxLifetime(0)
+
+	return &DB{DB: conn}, nil
+}
@@ -0,0 +1,167 @@
+// Package testserver runs the whole service in process for tests: the graph
+// of the binary, served over an in-memory listener, on an in-memory SQLite
+// database that backs every repository unless another one is given.
+package testserver
+
+import (
+	"context"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	pkgGrpc "github.com/vorotilkin/twitter-users/pkg/grpc"
+	"github.com/vorotilkin/twitter-users/pkg/sqlite"
+	"github.com/vorotilkin/twitter-users/proto"
+	"github.com/vorotilkin/twitter-users/server/app"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	bufferSize   = 1 << 20
+	startTimeout = 15 * time.Second
+	stopTimeout  = 5 * time.Second
+)
+
+type Option func(*options)
+
+type options struct {
+	configure       []func(c *app.Config)
+	usersRepository usecases.UsersRepository
+	logger          *zap.Logger
+	fxOptions       []fx.Option
+}
+
+// WithConfig changes the configuration before the service is built. It
+// starts from app.DefaultConfig with the metrics server and the gateway
+// turned off and the SQLite driver on a migrated in-memory database, so
+// nothing listens on a port or needs an external service.
+func WithConfig(configure func(c *app.Config)) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, configure)
+	}
+}
+
+// WithUsersRepository replaces the SQLite users repository. The caching and
+// batching layers of the service still wrap it. When repo also implements
+// usecases.UsernameRepository or usecases.FollowGraphRepository, it serves
+// those too; the other repositories stay on SQLite.
+func WithUsersRepository(repo usecases.UsersRepository) Option {
+	return func(o *options) {
+		o.usersRepository = repo
+	}
+}
+
+// WithLogger replaces the no-op logger, for instance with zaptest.NewLogger.
+func WithLogger(log *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = log
+	}
+}
+
+// WithFxOptions adds options to the graph, such as fx.Decorate to replace
+// the mailer or a repository other than the users one.
+func WithFxOptions(opts ...fx.Option) Option {
+	return func(o *options) {
+		o.fxOptions = append(o.fxOptions, opts...)
+	}
+}
+
+type Server struct {
+	Client proto.UsersClient
+	Conn   *grpc.ClientConn
+}
+
+// New starts the service and returns a client connected to it. The service
+// is stopped when the test ends.
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	o := &options{logger: zap.NewNop()}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	c := app.DefaultConfig()
+	c.Metrics.Enabled = false
+	c.Gateway.Enabled = false
+	c.Db.Driver = database.DriverSqlite
+	c.Sqlite.Path = sqlite.MemoryPath
+	c.Grpc.Server.Shutdown = pkgGrpc.ShutdownConfig{Timeout: stopTimeout}
+
+	for _, configure := range o.configure {
+		configure(c)
+	}
+
+	err := c.Validate()
+	if err != nil {
+		t.Fatalf("testserver: %v", err)
+	}
+
+	listener := bufconn.Listen(bufferSize)
+
+	// Decorations here apply before those of the service, which wraps the
+	// repositories in its caching layers.
+	fxOptions := []fx.Option{
+		app.Options(c),
+		fx.Decorate(func(*zap.Logger) *zap.Logger { return o.logger }),
+		fx.Invoke(func(server *pkgGrpc.Server) { server.UseListener(listener) }),
+	}
+
+	if o.usersRepository != nil {
+		fxOptions = append(fxOptions,
+			fx.Decorate(func(usecases.UsersRepository) usecases.UsersRepository { return o.usersRepository }))
+	}
+
+	if usernames, ok := o.usersRepository.(usecases.UsernameRepository); ok {
+		fxOptions = append(fxOptions,
+			fx.Decorate(func(usecases.UsernameRepository) usecases.UsernameRepository { return usernames }))
+	}
+
+	if followGraph, ok := o.usersRepository.(usecases.FollowGraphRepository); ok {
+		fxOptions = append(fxOptions,
+			fx.Decorate(func(usecases.FollowGraphRepository) usecases.FollowGraphRepository { return followGraph }))
+	}
+
+	application := fx.New(append(fxOptions, o.fxOptions...)...)
+
+	startCtx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+
+	err = application.Start(startCtx)
+	if err != nil {
+		t.Fatalf("testserver: start: %v", err)
+	}
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("testserver: dial: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+
+		stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		defer cancel()
+
+		err := application.Stop(stopCtx)
+		if err != nil {
+			t.Errorf("testserver: stop: %v", err)
+		}
+	})
+
+	return &Server{
+		Client: proto.NewUsersClient(conn),
+		Conn:   conn,
+	}
+}
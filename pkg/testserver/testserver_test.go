@@ -0,0 +1,212 @@
+package testserver_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/memory"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"github.com/vorotilkin/twitter-users/pkg/testserver"
+	"github.com/vorotilkin/twitter-users/proto"
+	"github.com/vorotilkin/twitter-users/server/app"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"go.uber.org/fx"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestCreateAndFetch(t *testing.T) {
+	client := testserver.New(t).Client
+	ctx := context.Background()
+
+	created, err := client.Create(ctx, &proto.CreateRequest{
+		Name:         "Alice",
+		PasswordHash: "hash",
+		Username:     "alice",
+		Email:        "alice@example.com",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, created.GetUser().GetPasswordHash(), "hashes never leave the service")
+
+	var header metadata.MD
+
+	users, err := client.UsersByIDs(ctx, &proto.UsersByIDsRequest{Ids: []int32{created.GetUser().GetId()}}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, users.GetUsers(), 1)
+	assert.Equal(t, "alice", users.GetUsers()[0].GetUsername())
+	assert.Empty(t, users.GetUsers()[0].GetPasswordHash())
+	assert.NotEmpty(t, header.Get(requestid.MetadataKey), "request id interceptor")
+
+	_, err = client.Create(ctx, &proto.CreateRequest{
+		Name:         "Alice",
+		PasswordHash: "hash",
+		Username:     "alice2",
+		Email:        "alice@example.com",
+	})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestValidation(t *testing.T) {
+	client := testserver.New(t).Client
+	ctx := context.Background()
+
+	_, err := client.UsersByIDs(ctx, &proto.UsersByIDsRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Follow(ctx, &proto.FollowRequest{UserId: 1, TargetUserId: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestReleasedUsernameIsReserved(t *testing.T) {
+	client := testserver.New(t).Client
+	ctx := context.Background()
+
+	alice, err := client.Create(ctx, &proto.CreateRequest{Name: "Alice", PasswordHash: "hash", Username: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	renamed := "liddell"
+	_, err = client.UpdateByID(ctx, &proto.UpdateByIDRequest{Id: alice.GetUser().GetId(), Username: &renamed})
+	require.NoError(t, err)
+
+	_, err = client.Create(ctx, &proto.CreateRequest{Name: "Eve", PasswordHash: "hash", Username: "alice", Email: "eve@example.com"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestKnownFollowers(t *testing.T) {
+	client := testserver.New(t).Client
+	ctx := context.Background()
+
+	ids := make(map[string]int32)
+	for _, username := range []string{"viewer", "target", "alice", "bob"} {
+		created, err := client.Create(ctx, &proto.CreateRequest{Name: username, PasswordHash: "hash", Username: username, Email: username + "@example.com"})
+		require.NoError(t, err)
+
+		ids[username] = created.GetUser().GetId()
+	}
+
+	for _, follow := range [][2]string{{"viewer", "alice"}, {"viewer", "bob"}, {"bob", "target"}, {"alice", "target"}} {
+		_, err := client.Follow(ctx, &proto.FollowRequest{UserId: ids[follow[0]], TargetUserId: ids[follow[1]]})
+		require.NoError(t, err)
+	}
+
+	response, err := client.KnownFollowers(ctx, &proto.KnownFollowersRequest{ViewerId: ids["viewer"], TargetId: ids["target"], Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, response.GetUsers(), 1)
+	assert.Equal(t, "alice", response.GetUsers()[0].GetUsername())
+	assert.Empty(t, response.GetUsers()[0].GetPasswordHash(), "known followers are hydrated like any user")
+	assert.EqualValues(t, 2, response.GetTotal())
+
+	_, err = client.KnownFollowers(ctx, &proto.KnownFollowersRequest{ViewerId: ids["viewer"], TargetId: ids["target"], Limit: 1000})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.KnownFollowers(ctx, &proto.KnownFollowersRequest{TargetId: ids["target"]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// slowLookups delays looking users up by email, as a loaded database would.
+type slowLookups struct {
+	*memory.UsersRepository
+	delay time.Duration
+}
+
+func (r slowLookups) UserByEmail(ctx context.Context, email string) (models.User, error) {
+	time.Sleep(r.delay)
+
+	return r.UsersRepository.UserByEmail(ctx, email)
+}
+
+func TestPasswordResetTakesTheResponseTime(t *testing.T) {
+	client := testserver.New(t,
+		testserver.WithUsersRepository(slowLookups{UsersRepository: memory.NewUsersRepository(), delay: time.Second}),
+		testserver.WithConfig(func(c *app.Config) { c.Users.PasswordResetResponseTime = 50 * time.Millisecond }),
+	).Client
+
+	start := time.Now()
+
+	_, err := client.RequestPasswordReset(context.Background(), &proto.RequestPasswordResetRequest{Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+	assert.Less(t, elapsed, 500*time.Millisecond, "the lookup must not delay the response")
+}
+
+// mailbox hands the codes of the mails the service sends to the test.
+type mailbox chan string
+
+var codePattern = regexp.MustCompile(`code to [a-z ]+: (\S+)`)
+
+func (m mailbox) Send(_ context.Context, _, _, body string) error {
+	if match := codePattern.FindStringSubmatch(body); match != nil {
+		m <- match[1]
+	}
+
+	return nil
+}
+
+func (m mailbox) code(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case code := <-m:
+		return code
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail with a code")
+		return ""
+	}
+}
+
+func TestAccountFlows(t *testing.T) {
+	mails := make(mailbox, 1)
+	server := testserver.New(t,
+		testserver.WithConfig(func(c *app.Config) {
+			c.Users.PasswordHashCost = bcrypt.MinCost
+			c.Users.PasswordResetResponseTime = time.Millisecond
+		}),
+		testserver.WithFxOptions(fx.Decorate(func(usecases.Mailer) usecases.Mailer { return mails })))
+	client := server.Client
+	ctx := context.Background()
+
+	health, err := healthpb.NewHealthClient(server.Conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, health.GetStatus(), "no external service is missing")
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("first-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	created, err := client.Create(ctx, &proto.CreateRequest{Name: "Alice", PasswordHash: string(hash), Username: "alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	alice := created.GetUser().GetId()
+
+	_, err = client.ChangePassword(ctx, &proto.ChangePasswordRequest{UserId: alice, CurrentPassword: "first-password", NewPassword: "second-password"})
+	require.NoError(t, err)
+
+	_, err = client.ChangePassword(ctx, &proto.ChangePasswordRequest{UserId: alice, CurrentPassword: "first-password", NewPassword: "third-password"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "the old password no longer works")
+
+	_, err = client.RequestPasswordReset(ctx, &proto.RequestPasswordResetRequest{Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	_, err = client.ResetPassword(ctx, &proto.ResetPasswordRequest{Token: mails.code(t), NewPassword: "third-password"})
+	require.NoError(t, err)
+
+	_, err = client.RequestEmailChange(ctx, &proto.RequestEmailChangeRequest{UserId: alice, NewEmail: "alicia@example.com"})
+	require.NoError(t, err)
+
+	confirmed, err := client.ConfirmEmailChange(ctx, &proto.ConfirmEmailChangeRequest{Token: mails.code(t)})
+	require.NoError(t, err)
+	assert.Equal(t, "alicia@example.com", confirmed.GetUser().GetEmail())
+
+	found, err := client.UserByEmail(ctx, &proto.UserByEmailRequest{Email: "alicia@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, alice, found.GetUser().GetId())
+}
@@ -0,0 +1,31 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const size = 32
+
+// New returns a random url-safe token and its hash. Only the hash should be
+// persisted; the plain token is handed to the user.
+func New() (plain string, hash string, err error) {
+	buf := make([]byte, size)
+
+	_, err = rand.Read(buf)
+	if err != nil {
+		return "", "", err
+	}
+
+	plain = base64.RawURLEncoding.EncodeToString(buf)
+
+	return plain, Hash(plain), nil
+}
+
+func Hash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+
+	return hex.EncodeToString(sum[:])
+}
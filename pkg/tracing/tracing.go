@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+
+	defaultServiceName = "twitter-users"
+)
+
+type Config struct {
+	Exporter    string
+	ServiceName string
+	// Endpoint is the OTLP gRPC collector address.
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the share of new traces to sample, from 0 to 1.
+	// Traces started upstream follow the caller's decision.
+	SampleRatio float64
+}
+
+// Provider owns the global tracer provider and flushes it on stop.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+}
+
+func (p *Provider) TracerProvider() trace.TracerProvider {
+	if p.provider == nil {
+		return noop.NewTracerProvider()
+	}
+
+	return p.provider
+}
+
+func (p *Provider) OnStart(_ context.Context) error {
+	return nil
+}
+
+func (p *Provider) OnStop(ctx context.Context) error {
+	if p.provider == nil {
+		return nil
+	}
+
+	return p.provider.Shutdown(ctx)
+}
+
+func New(c Config) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporter, err := newExporter(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if exporter == nil {
+		return &Provider{}, nil
+	}
+
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return &Provider{provider: provider}, nil
+}
+
+func newExporter(c Config) (sdktrace.SpanExporter, error) {
+	switch c.Exporter {
+	case ExporterStdout:
+		return stdouttrace.New()
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.Endpoint)}
+		if c.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		return otlptracegrpc.New(context.Background(), opts...)
+	case ExporterNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", c.Exporter)
+	}
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	switch c.Exporter {
+	case ExporterNone, ExporterStdout, "":
+	case ExporterOTLP:
+		if c.Endpoint == "" {
+			errs = append(errs, errors.New("endpoint is required for the otlp exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown exporter %q", c.Exporter))
+	}
+
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("sampleRatio must be between 0 and 1, got %v", c.SampleRatio))
+	}
+
+	return errors.Join(errs...)
+}
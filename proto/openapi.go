@@ -0,0 +1,8 @@
+package proto
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI v2 document generated from users.proto.
+//
+//go:embed users.swagger.json
+var OpenAPI []byte
@@ -12,17 +12,18 @@ import (
 )
 
 type User struct {
-	ID              int32 `sql:"primary_key"`
-	Name            string
-	PasswordHash    string
-	Username        string
-	Email           string
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
-	Bio             *string
-	EmailVerified   *time.Time
-	Image           *string
-	CoverImage      *string
-	ProfileImage    *string
-	HasNotification bool
+	ID                int32 `sql:"primary_key"`
+	Name              string
+	PasswordHash      string
+	Username          string
+	Email             string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Bio               *string
+	EmailVerified     *time.Time
+	Image             *string
+	CoverImage        *string
+	ProfileImage      *string
+	HasNotification   bool
+	PasswordChangedAt *time.Time
 }
@@ -10,6 +10,11 @@ package table
 // UseSchema sets a new schema name for all generated table SQL builder types. It is recommended to invoke
 // this method only once at the beginning of the program.
 func UseSchema(schema string) {
+	EmailChange = EmailChange.FromSchema(schema)
 	Follow = Follow.FromSchema(schema)
+	PasswordHistory = PasswordHistory.FromSchema(schema)
+	PasswordResetToken = PasswordResetToken.FromSchema(schema)
+	RateLimitBucket = RateLimitBucket.FromSchema(schema)
 	User = User.FromSchema(schema)
+	UsernameHistory = UsernameHistory.FromSchema(schema)
 }
@@ -0,0 +1,8 @@
+-- Modify "user" table
+ALTER TABLE "user" ADD COLUMN "password_changed_at" timestamp NULL;
+-- Create "password_history" table
+CREATE TABLE "password_history" ("id" serial NOT NULL, "user_id" integer NOT NULL, "password_hash" text NOT NULL, "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), CONSTRAINT "fk_password_history_user_id" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
+-- Create index "idx_password_history_user_id_created_at" to table: "password_history"
+CREATE INDEX "idx_password_history_user_id_created_at" ON "password_history" ("user_id", "created_at");
+-- Set comment to column: "password_hash" on table: "password_history"
+COMMENT ON COLUMN "password_history"."password_hash" IS 'Хеш одного из предыдущих паролей пользователя';
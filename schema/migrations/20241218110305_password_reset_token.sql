@@ -0,0 +1,10 @@
+-- Create "password_reset_token" table
+CREATE TABLE "password_reset_token" ("token_hash" text NOT NULL, "user_id" integer NOT NULL, "expires_at" timestamp NOT NULL, "used_at" timestamp NULL, "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("token_hash"), CONSTRAINT "fk_password_reset_token_user_id" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
+-- Create index "idx_password_reset_token_user_id" to table: "password_reset_token"
+CREATE INDEX "idx_password_reset_token_user_id" ON "password_reset_token" ("user_id");
+-- Create index "idx_password_reset_token_expires_at" to table: "password_reset_token"
+CREATE INDEX "idx_password_reset_token_expires_at" ON "password_reset_token" ("expires_at");
+-- Set comment to column: "token_hash" on table: "password_reset_token"
+COMMENT ON COLUMN "password_reset_token"."token_hash" IS 'SHA-256 хеш токена сброса пароля';
+-- Set comment to column: "used_at" on table: "password_reset_token"
+COMMENT ON COLUMN "password_reset_token"."used_at" IS 'Момент использования, токен одноразовый';
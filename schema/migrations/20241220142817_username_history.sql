@@ -0,0 +1,10 @@
+-- Create "username_history" table
+CREATE TABLE "username_history" ("id" serial NOT NULL, "user_id" integer NOT NULL, "username" text NOT NULL, "changed_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), CONSTRAINT "fk_username_history_user_id" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
+-- Create index "idx_username_history_username_changed_at" to table: "username_history"
+CREATE INDEX "idx_username_history_username_changed_at" ON "username_history" ("username", "changed_at");
+-- Create index "idx_user_username" to table: "user"
+CREATE INDEX "idx_user_username" ON "user" ("username");
+-- Set comment to column: "username" on table: "username_history"
+COMMENT ON COLUMN "username_history"."username" IS 'Прежний никнейм пользователя';
+-- Set comment to column: "changed_at" on table: "username_history"
+COMMENT ON COLUMN "username_history"."changed_at" IS 'Момент, когда никнейм был освобождён';
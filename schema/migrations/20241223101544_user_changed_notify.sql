@@ -0,0 +1,23 @@
+-- Create "notify_user_changed" function
+CREATE FUNCTION "notify_user_changed"() RETURNS trigger LANGUAGE plpgsql AS $$
+DECLARE
+  changed record;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    changed := OLD;
+  ELSE
+    changed := NEW;
+  END IF;
+  IF TG_TABLE_NAME = 'follow' THEN
+    PERFORM pg_notify('user_changed', changed.user_id::text);
+    PERFORM pg_notify('user_changed', changed.following_user_id::text);
+  ELSE
+    PERFORM pg_notify('user_changed', changed.id::text);
+  END IF;
+  RETURN NULL;
+END;
+$$;
+-- Create trigger "user_changed_notify"
+CREATE TRIGGER "user_changed_notify" AFTER UPDATE OR DELETE ON "user" FOR EACH ROW EXECUTE FUNCTION "notify_user_changed"();
+-- Create trigger "follow_changed_notify"
+CREATE TRIGGER "follow_changed_notify" AFTER INSERT OR DELETE ON "follow" FOR EACH ROW EXECUTE FUNCTION "notify_user_changed"();
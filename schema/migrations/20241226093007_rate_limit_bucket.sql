@@ -0,0 +1,10 @@
+-- Create "rate_limit_bucket" table
+CREATE TABLE "rate_limit_bucket" ("key" text NOT NULL, "tokens" double precision NOT NULL, "updated_at" timestamp NOT NULL, "expires_at" timestamp NOT NULL, PRIMARY KEY ("key"));
+-- Create index "idx_rate_limit_bucket_expires_at" to table: "rate_limit_bucket"
+CREATE INDEX "idx_rate_limit_bucket_expires_at" ON "rate_limit_bucket" ("expires_at");
+-- Set comment to column: "key" on table: "rate_limit_bucket"
+COMMENT ON COLUMN "rate_limit_bucket"."key" IS 'Ключ лимита: метод и вызывающий';
+-- Set comment to column: "tokens" on table: "rate_limit_bucket"
+COMMENT ON COLUMN "rate_limit_bucket"."tokens" IS 'Токены, оставшиеся на момент updated_at';
+-- Set comment to column: "expires_at" on table: "rate_limit_bucket"
+COMMENT ON COLUMN "rate_limit_bucket"."expires_at" IS 'Момент, когда бакет снова заполнится и его можно удалить';
@@ -0,0 +1,2 @@
+-- Drop "user" table
+DROP TABLE "user";
@@ -0,0 +1,2 @@
+-- Modify "user" table
+ALTER TABLE "user" DROP COLUMN "bio", DROP COLUMN "email_verified", DROP COLUMN "image", DROP COLUMN "cover_image", DROP COLUMN "profile_image", DROP COLUMN "has_notification";
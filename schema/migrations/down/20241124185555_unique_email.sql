@@ -0,0 +1,2 @@
+-- Modify "user" table
+ALTER TABLE "user" DROP CONSTRAINT "user_pk";
@@ -0,0 +1,2 @@
+-- Drop "follow" table
+DROP TABLE "follow";
@@ -0,0 +1,2 @@
+-- Drop "email_change" table
+DROP TABLE "email_change";
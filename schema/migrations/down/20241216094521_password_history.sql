@@ -0,0 +1,4 @@
+-- Drop "password_history" table
+DROP TABLE "password_history";
+-- Modify "user" table
+ALTER TABLE "user" DROP COLUMN "password_changed_at";
@@ -0,0 +1,4 @@
+-- Drop index "idx_user_username" from table: "user"
+DROP INDEX "idx_user_username";
+-- Drop "username_history" table
+DROP TABLE "username_history";
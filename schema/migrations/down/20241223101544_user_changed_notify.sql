@@ -0,0 +1,6 @@
+-- Drop trigger "follow_changed_notify" from table: "follow"
+DROP TRIGGER "follow_changed_notify" ON "follow";
+-- Drop trigger "user_changed_notify" from table: "user"
+DROP TRIGGER "user_changed_notify" ON "user";
+-- Drop "notify_user_changed" function
+DROP FUNCTION "notify_user_changed"();
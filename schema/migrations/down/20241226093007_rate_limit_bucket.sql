@@ -0,0 +1,2 @@
+-- Drop "rate_limit_bucket" table
+DROP TABLE "rate_limit_bucket";
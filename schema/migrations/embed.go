@@ -0,0 +1,11 @@
+// Package migrations embeds the schema migrations, so the service applies
+// them without the atlas CLI or a checkout of the repository.
+package migrations
+
+import "embed"
+
+// FS holds the up migrations with their atlas.sum at the root and the
+// matching down migrations, under the same names, in down/.
+//
+//go:embed *.sql atlas.sum down/*.sql
+var FS embed.FS
@@ -0,0 +1,4 @@
+-- Create "user" table
+CREATE TABLE "user" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT, "name" text NOT NULL, "password_hash" text NOT NULL, "username" text NOT NULL, "email" text NOT NULL, "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, "updated_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP);
+-- Create index "idx_id" to table: "user"
+CREATE INDEX "idx_id" ON "user" ("id");
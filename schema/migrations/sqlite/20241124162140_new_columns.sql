@@ -0,0 +1,7 @@
+-- Modify "user" table
+ALTER TABLE "user" ADD COLUMN "bio" text NULL;
+ALTER TABLE "user" ADD COLUMN "email_verified" timestamp NULL;
+ALTER TABLE "user" ADD COLUMN "image" text NULL;
+ALTER TABLE "user" ADD COLUMN "cover_image" text NULL;
+ALTER TABLE "user" ADD COLUMN "profile_image" text NULL;
+ALTER TABLE "user" ADD COLUMN "has_notification" boolean NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- Create index "user_pk" to table: "user"
+CREATE UNIQUE INDEX "user_pk" ON "user" ("email");
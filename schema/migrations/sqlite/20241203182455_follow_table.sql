@@ -0,0 +1,6 @@
+-- Create "follow" table
+CREATE TABLE "follow" ("user_id" integer NOT NULL, "following_user_id" integer NOT NULL, "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("user_id", "following_user_id"), CONSTRAINT "fk_follow_following_user_id" FOREIGN KEY ("following_user_id") REFERENCES "user" ("id") ON UPDATE NO ACTION ON DELETE CASCADE, CONSTRAINT "fk_follow_user_id" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
+-- Create index "idx_follow_following_user_id" to table: "follow"
+CREATE INDEX "idx_follow_following_user_id" ON "follow" ("following_user_id");
+-- Create index "idx_follow_user_id" to table: "follow"
+CREATE INDEX "idx_follow_user_id" ON "follow" ("user_id");
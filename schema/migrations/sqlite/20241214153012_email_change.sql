@@ -0,0 +1,4 @@
+-- Create "email_change" table
+CREATE TABLE "email_change" ("user_id" integer NOT NULL, "new_email" text NOT NULL, "token_hash" text NOT NULL, "expires_at" timestamp NOT NULL, "created_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("user_id"), CONSTRAINT "fk_email_change_user_id" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
+-- Create index "idx_email_change_token_hash" to table: "email_change"
+CREATE UNIQUE INDEX "idx_email_change_token_hash" ON "email_change" ("token_hash");
@@ -0,0 +1,6 @@
+-- Create "username_history" table
+CREATE TABLE "username_history" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT, "user_id" integer NOT NULL, "username" text NOT NULL, "changed_at" timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, CONSTRAINT "fk_username_history_user_id" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
+-- Create index "idx_username_history_username_changed_at" to table: "username_history"
+CREATE INDEX "idx_username_history_username_changed_at" ON "username_history" ("username", "changed_at");
+-- Create index "idx_user_username" to table: "user"
+CREATE INDEX "idx_user_username" ON "user" ("username");
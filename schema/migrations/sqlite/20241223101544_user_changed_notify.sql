@@ -0,0 +1,3 @@
+-- SQLite has no LISTEN/NOTIFY. A single instance runs on it and its cache
+-- drops the users it changes itself, so there is nothing to notify.
+SELECT 1;
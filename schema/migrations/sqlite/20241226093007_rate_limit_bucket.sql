@@ -0,0 +1,4 @@
+-- Create "rate_limit_bucket" table
+CREATE TABLE "rate_limit_bucket" ("key" text NOT NULL, "tokens" double precision NOT NULL, "updated_at" timestamp NOT NULL, "expires_at" timestamp NOT NULL, PRIMARY KEY ("key"));
+-- Create index "idx_rate_limit_bucket_expires_at" to table: "rate_limit_bucket"
+CREATE INDEX "idx_rate_limit_bucket_expires_at" ON "rate_limit_bucket" ("expires_at");
@@ -0,0 +1,12 @@
+// Package sqlite embeds the SQLite counterparts of the schema migrations.
+// Every file mirrors the Postgres migration of the same name, so both
+// schemas move through the same versions.
+package sqlite
+
+import "embed"
+
+// FS holds the up migrations with their atlas.sum. SQLite is only used in
+// development, so there are no down migrations.
+//
+//go:embed *.sql atlas.sum
+var FS embed.FS
@@ -55,12 +55,19 @@ table "user" {
     type    = boolean
     default = false
   }
+  column "password_changed_at" {
+    null = true
+    type = timestamp
+  }
   primary_key {
     columns = [column.id]
   }
   index "idx_id" {
     columns = [column.id]
   }
+  index "idx_user_username" {
+    columns = [column.username]
+  }
   unique "user_pk" {
     columns = [column.email]
   }
@@ -111,6 +118,214 @@ table "follow" {
     columns = [column.following_user_id]
   }
 }
+table "email_change" {
+  schema = schema.public
+
+  column "user_id" {
+    null = false
+    type = integer
+  }
+
+  column "new_email" {
+    null = false
+    type = text
+    comment = "Новый адрес, ожидающий подтверждения"
+  }
+
+  column "token_hash" {
+    null = false
+    type = text
+    comment = "SHA-256 хеш токена подтверждения"
+  }
+
+  column "expires_at" {
+    null = false
+    type = timestamp
+  }
+
+  column "created_at" {
+    null    = false
+    type    = timestamp
+    default = sql("CURRENT_TIMESTAMP")
+  }
+
+  primary_key {
+    columns = [column.user_id]
+  }
+
+  foreign_key "fk_email_change_user_id" {
+    columns    = [column.user_id]
+    ref_columns = [table.user.column.id]
+    on_delete = CASCADE
+  }
+
+  index "idx_email_change_token_hash" {
+    unique  = true
+    columns = [column.token_hash]
+  }
+}
+table "password_history" {
+  schema = schema.public
+
+  column "id" {
+    null = false
+    type = serial
+  }
+
+  column "user_id" {
+    null = false
+    type = integer
+  }
+
+  column "password_hash" {
+    null = false
+    type = text
+    comment = "Хеш одного из предыдущих паролей пользователя"
+  }
+
+  column "created_at" {
+    null    = false
+    type    = timestamp
+    default = sql("CURRENT_TIMESTAMP")
+  }
+
+  primary_key {
+    columns = [column.id]
+  }
+
+  foreign_key "fk_password_history_user_id" {
+    columns    = [column.user_id]
+    ref_columns = [table.user.column.id]
+    on_delete = CASCADE
+  }
+
+  index "idx_password_history_user_id_created_at" {
+    columns = [column.user_id, column.created_at]
+  }
+}
+table "password_reset_token" {
+  schema = schema.public
+
+  column "token_hash" {
+    null = false
+    type = text
+    comment = "SHA-256 хеш токена сброса пароля"
+  }
+
+  column "user_id" {
+    null = false
+    type = integer
+  }
+
+  column "expires_at" {
+    null = false
+    type = timestamp
+  }
+
+  column "used_at" {
+    null = true
+    type = timestamp
+    comment = "Момент использования, токен одноразовый"
+  }
+
+  column "created_at" {
+    null    = false
+    type    = timestamp
+    default = sql("CURRENT_TIMESTAMP")
+  }
+
+  primary_key {
+    columns = [column.token_hash]
+  }
+
+  foreign_key "fk_password_reset_token_user_id" {
+    columns    = [column.user_id]
+    ref_columns = [table.user.column.id]
+    on_delete = CASCADE
+  }
+
+  index "idx_password_reset_token_user_id" {
+    columns = [column.user_id]
+  }
+
+  index "idx_password_reset_token_expires_at" {
+    columns = [column.expires_at]
+  }
+}
+table "username_history" {
+  schema = schema.public
+
+  column "id" {
+    null = false
+    type = serial
+  }
+
+  column "user_id" {
+    null = false
+    type = integer
+  }
+
+  column "username" {
+    null = false
+    type = text
+    comment = "Прежний никнейм пользователя"
+  }
+
+  column "changed_at" {
+    null    = false
+    type    = timestamp
+    default = sql("CURRENT_TIMESTAMP")
+    comment = "Момент, когда никнейм был освобождён"
+  }
+
+  primary_key {
+    columns = [column.id]
+  }
+
+  foreign_key "fk_username_history_user_id" {
+    columns    = [column.user_id]
+    ref_columns = [table.user.column.id]
+    on_delete = CASCADE
+  }
+
+  index "idx_username_history_username_changed_at" {
+    columns = [column.username, column.changed_at]
+  }
+}
+table "rate_limit_bucket" {
+  schema = schema.public
+
+  column "key" {
+    null = false
+    type = text
+    comment = "Ключ лимита: метод и вызывающий"
+  }
+
+  column "tokens" {
+    null = false
+    type = double_precision
+    comment = "Токены, оставшиеся на момент updated_at"
+  }
+
+  column "updated_at" {
+    null = false
+    type = timestamp
+  }
+
+  column "expires_at" {
+    null = false
+    type = timestamp
+    comment = "Момент, когда бакет снова заполнится и его можно удалить"
+  }
+
+  primary_key {
+    columns = [column.key]
+  }
+
+  index "idx_rate_limit_bucket_expires_at" {
+    columns = [column.expires_at]
+  }
+}
 schema "public" {
   comment = "standard public schema"
 }
@@ -0,0 +1,289 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/batched"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/cached"
+	sqliteRepository "github.com/vorotilkin/twitter-users/infrastructure/repositories/sqlite"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/user"
+	"github.com/vorotilkin/twitter-users/interfaces"
+	"github.com/vorotilkin/twitter-users/pkg/auth"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/pkg/gateway"
+	pkgGrpc "github.com/vorotilkin/twitter-users/pkg/grpc"
+	"github.com/vorotilkin/twitter-users/pkg/health"
+	"github.com/vorotilkin/twitter-users/pkg/mailer"
+	"github.com/vorotilkin/twitter-users/pkg/metrics"
+	"github.com/vorotilkin/twitter-users/pkg/migration"
+	"github.com/vorotilkin/twitter-users/pkg/ratelimit"
+	"github.com/vorotilkin/twitter-users/pkg/sqlite"
+	"github.com/vorotilkin/twitter-users/pkg/tracing"
+	"github.com/vorotilkin/twitter-users/proto"
+	"github.com/vorotilkin/twitter-users/schema/migrations"
+	sqliteMigrations "github.com/vorotilkin/twitter-users/schema/migrations/sqlite"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"github.com/vorotilkin/twitter-users/usecases/workers"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxevent"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Options builds the service from c. Everything but config reloading is
+// here, so that tests run the same graph as the binary.
+func Options(c *Config) fx.Option {
+	return fx.Options(
+		fx.WithLogger(func(log *zap.Logger) fxevent.Logger {
+			return &fxevent.ZapLogger{Logger: log}
+		}),
+		// The module lets tests decorate its dependencies, such as the
+		// repositories, from outside before it decorates them itself.
+		fx.Module("twitter-users",
+			fx.Supply(c),
+			fx.Provide(NewLogger),
+			fx.Provide(func(c *Config) pkgGrpc.Config {
+				return c.Grpc.Server
+			}),
+			fx.Provide(func(c *Config) tracing.Config { return c.Tracing }),
+			fx.Provide(tracing.New),
+			fx.Provide(func(p *tracing.Provider) trace.TracerProvider { return p.TracerProvider() }),
+			fx.Provide(func(c *Config) auth.Config { return c.Auth }),
+			fx.Provide(func(c auth.Config, log *zap.Logger) (*auth.Authenticator, error) {
+				return auth.NewAuthenticator(c, log, usecases.Policy(), pkgGrpc.HealthPolicy())
+			}),
+			fx.Provide(func(c *Config) ratelimit.Config { return c.RateLimit }),
+			// There is no *database.Database on the sqlite driver, and Validate
+			// rejects the postgres store, the only one using it, there.
+			fx.Provide(fx.Annotate(ratelimit.New, fx.ParamTags(``, ``, `optional:"true"`))),
+			// Shared by the gateway and the limiter, which trusts the client
+			// IP the gateway forwards.
+			fx.Provide(gateway.NewSecret),
+			fx.Provide(fx.Annotate(func(
+				authenticator *auth.Authenticator,
+				limiter *ratelimit.Limiter,
+				db *database.Database,
+			) pkgGrpc.Interceptors {
+				unary := []grpc.UnaryServerInterceptor{
+					authenticator.UnaryServerInterceptor(),
+					limiter.UnaryServerInterceptor(),
+				}
+				if db != nil {
+					unary = append(unary, databaseSessionInterceptor(db))
+				}
+
+				return pkgGrpc.Interceptors{
+					Unary:  unary,
+					Stream: []grpc.StreamServerInterceptor{authenticator.StreamServerInterceptor()},
+				}
+			}, fx.ParamTags(``, ``, `optional:"true"`))),
+			fx.Provide(fx.Annotate(pkgGrpc.NewServer,
+				fx.As(fx.Self()),
+				fx.As(new(grpc.ServiceRegistrar)),
+				fx.As(new(interfaces.Hooker)),
+				fx.As(new(health.StatusSetter)))),
+			fx.Provide(func(c *Config) health.Config { return c.Health }),
+			fx.Provide(health.NewChecker),
+			fx.Provide(func(c *Config) mailer.Config { return c.Mailer }),
+			fx.Provide(func(c *Config) usecases.Config { return c.Users }),
+			fx.Provide(func(c *Config) workers.Config { return c.Workers }),
+			fx.Provide(workers.NewTokenCleaner),
+			fx.Provide(fx.Annotate(mailer.New, fx.As(new(usecases.Mailer)))),
+			fx.Provide(func(c *Config) cache.Config { return c.Cache }),
+			fx.Provide(cache.New),
+			fx.Provide(func(c *Config) batched.Config { return c.Batching }),
+			fx.Decorate(func(
+				repo usecases.UsersRepository,
+				batchingConfig batched.Config,
+				cache cache.Cache,
+				log *zap.Logger,
+			) usecases.UsersRepository {
+				return cached.NewUsersRepository(batched.NewUsersRepository(repo, batchingConfig), cache, log)
+			}),
+			fx.Decorate(fx.Annotate(cached.NewEmailChangeRepository, fx.As(new(usecases.EmailChangeRepository)))),
+			fx.Decorate(fx.Annotate(cached.NewPasswordRepository, fx.As(new(usecases.PasswordRepository)))),
+			fx.Decorate(fx.Annotate(cached.NewPasswordResetRepository, fx.As(new(usecases.PasswordResetRepository)))),
+			fx.Provide(fx.Annotate(usecases.NewUsersServer, fx.As(new(proto.UsersServer)))),
+			fx.Invoke(func(lc fx.Lifecycle, provider *tracing.Provider) {
+				lc.Append(fx.Hook{
+					OnStart: provider.OnStart,
+					OnStop:  provider.OnStop,
+				})
+			}),
+			// fx stops hooks in reverse order: the gateway and then the gRPC
+			// server drain first, the database closes once nothing uses it and
+			// the tracer flushes last. Storage also applies the migrations.
+			storage(c),
+			fx.Provide(func(c *Config) metrics.Config { return c.Metrics }),
+			fx.Provide(metrics.NewServer),
+			fx.Invoke(func(lc fx.Lifecycle, server *metrics.Server) {
+				lc.Append(fx.Hook{
+					OnStart: server.OnStart,
+					OnStop:  server.OnStop,
+				})
+			}),
+			fx.Provide(func(c *Config) gateway.Config {
+				if c.Gateway.Endpoint == "" {
+					c.Gateway.Endpoint = c.Grpc.Server.Address
+				}
+
+				return c.Gateway
+			}),
+			fx.Provide(func(c gateway.Config, log *zap.Logger, secret gateway.Secret) *gateway.Server {
+				return gateway.NewServer(c, log, secret, proto.OpenAPI, proto.RegisterUsersHandler)
+			}),
+			fx.Invoke(func(lc fx.Lifecycle, limiter *ratelimit.Limiter) {
+				lc.Append(fx.Hook{
+					OnStart: limiter.OnStart,
+					OnStop:  limiter.OnStop,
+				})
+			}),
+			fx.Invoke(func(lc fx.Lifecycle, cleaner *workers.TokenCleaner) {
+				lc.Append(fx.Hook{
+					OnStart: cleaner.OnStart,
+					OnStop:  cleaner.OnStop,
+				})
+			}),
+			// Invokes run in order and a failed migration aborts startup, so
+			// reaching this one means the schema is up to date.
+			fx.Invoke(func(checker *health.Checker) { checker.SetMigrated() }),
+			fx.Invoke(func(lc fx.Lifecycle, checker *health.Checker) {
+				lc.Append(fx.Hook{
+					OnStart: checker.OnStart,
+					OnStop:  checker.OnStop,
+				})
+			}),
+			fx.Invoke(func(lc fx.Lifecycle, server interfaces.Hooker) {
+				lc.Append(fx.Hook{
+					OnStart: server.OnStart,
+					OnStop:  server.OnStop,
+				})
+			}),
+			// The gateway stops before the gRPC server it proxies to: both keep
+			// serving through the drain period, then the gateway finishes its
+			// calls while the gRPC server still answers them.
+			fx.Invoke(func(lc fx.Lifecycle, server *gateway.Server, grpcServer *pkgGrpc.Server) {
+				lc.Append(fx.Hook{
+					OnStart: server.OnStart,
+					OnStop: func(ctx context.Context) error {
+						grpcServer.Drain(ctx)
+
+						return server.OnStop(ctx)
+					},
+				})
+			}),
+			fx.Invoke(proto.RegisterUsersServer),
+		),
+	)
+}
+
+// storage provides the database the config selects, with the repositories
+// on top of it, and migrates it.
+func storage(c *Config) fx.Option {
+	if c.Db.Driver == database.DriverSqlite {
+		return sqliteStorage()
+	}
+
+	return postgresStorage()
+}
+
+func postgresStorage() fx.Option {
+	return fx.Options(
+		fx.Provide(func(c *Config) database.Config {
+			return c.Db
+		}),
+		fx.Provide(fx.Annotate(database.New, fx.As(fx.Self()), fx.As(new(health.Pinger)))),
+		fx.Provide(func(c *Config) migration.Config { return c.Migration }),
+		fx.Provide(fx.Annotate(func(c *Config) string { return c.Db.PostgresDSN() }, fx.ResultTags(`name:"dsn"`))),
+		fx.Provide(fx.Annotate(user.NewRepository,
+			fx.As(new(usecases.UsersRepository)),
+			fx.As(new(usecases.EmailChangeRepository)),
+			fx.As(new(usecases.PasswordRepository)),
+			fx.As(new(usecases.PasswordResetRepository)),
+			fx.As(new(usecases.UsernameRepository)),
+			fx.As(new(usecases.FollowGraphRepository)),
+			fx.As(new(workers.ExpiredTokensRepository)))),
+		fx.Provide(cached.NewInvalidator),
+		fx.Invoke(func(lc fx.Lifecycle, db *database.Database, log *zap.Logger) {
+			lc.Append(fx.Hook{
+				OnStart: db.OnStart,
+				OnStop: func(context.Context) error {
+					log.Info("closing database pool")
+					db.Close()
+
+					return nil
+				},
+			})
+		}),
+		fx.Invoke(func(db *database.Database) error {
+			// Apps sharing a process, as in tests, keep the first collector.
+			err := prometheus.Register(db.Collector())
+			if errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+				return nil
+			}
+
+			return err
+		}),
+		// The invalidator also closes the cache once it stops listening.
+		fx.Invoke(func(lc fx.Lifecycle, invalidator *cached.Invalidator) {
+			lc.Append(fx.Hook{
+				OnStart: invalidator.OnStart,
+				OnStop:  invalidator.OnStop,
+			})
+		}),
+		fx.Invoke(fx.Annotate(func(log *zap.Logger, c migration.Config, dsn string) error {
+			return migration.Do(log, c, dsn, migrations.FS)
+		}, fx.ParamTags("", "", `name:"dsn"`))),
+	)
+}
+
+// sqliteStorage runs a single instance on an embedded database. There is no
+// invalidator, as the cache already drops the users the instance changes.
+func sqliteStorage() fx.Option {
+	return fx.Options(
+		fx.Provide(func(c *Config) sqlite.Config { return c.Sqlite }),
+		fx.Provide(fx.Annotate(sqlite.Open, fx.As(fx.Self()), fx.As(new(health.Pinger)))),
+		fx.Provide(fx.Annotate(sqliteRepository.NewRepository,
+			fx.As(new(usecases.UsersRepository)),
+			fx.As(new(usecases.EmailChangeRepository)),
+			fx.As(new(usecases.PasswordRepository)),
+			fx.As(new(usecases.PasswordResetRepository)),
+			fx.As(new(usecases.UsernameRepository)),
+			fx.As(new(usecases.FollowGraphRepository)),
+			fx.As(new(workers.ExpiredTokensRepository)))),
+		fx.Invoke(func(lc fx.Lifecycle, db *sqlite.DB, cache cache.Cache, log *zap.Logger) {
+			lc.Append(fx.Hook{
+				OnStop: func(context.Context) error {
+					log.Info("closing database")
+
+					return errors.Join(db.Close(), cache.Close())
+				},
+			})
+		}),
+		fx.Invoke(func(db *sqlite.DB, c *Config, log *zap.Logger) error {
+			if !c.Migration.NeedMigration {
+				return nil
+			}
+
+			return sqlite.Migrate(context.Background(), db, log, sqliteMigrations.FS)
+		}),
+	)
+}
+
+// databaseSessionInterceptor lets the database keep the reads of a caller on
+// the primary after it writes. Unauthenticated callers share no session
+// across requests.
+func databaseSessionInterceptor(db *database.Database) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		caller := ""
+		if identity, ok := auth.FromContext(ctx); ok {
+			caller = fmt.Sprintf("%d/%s", identity.UserID, identity.Service)
+		}
+
+		return handler(db.WithSession(ctx, caller), req)
+	}
+}
@@ -0,0 +1,233 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vorotilkin/twitter-users/infrastructure/repositories/batched"
+	"github.com/vorotilkin/twitter-users/pkg/auth"
+	"github.com/vorotilkin/twitter-users/pkg/cache"
+	"github.com/vorotilkin/twitter-users/pkg/configuration"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/pkg/gateway"
+	pkgGrpc "github.com/vorotilkin/twitter-users/pkg/grpc"
+	"github.com/vorotilkin/twitter-users/pkg/health"
+	"github.com/vorotilkin/twitter-users/pkg/mailer"
+	"github.com/vorotilkin/twitter-users/pkg/metrics"
+	"github.com/vorotilkin/twitter-users/pkg/migration"
+	"github.com/vorotilkin/twitter-users/pkg/ratelimit"
+	"github.com/vorotilkin/twitter-users/pkg/sqlite"
+	"github.com/vorotilkin/twitter-users/pkg/tracing"
+	"github.com/vorotilkin/twitter-users/usecases"
+	"github.com/vorotilkin/twitter-users/usecases/workers"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"time"
+)
+
+// Config is the whole service configuration, one section per package.
+type Config struct {
+	Log struct {
+		Level string
+	}
+	Grpc struct {
+		Server pkgGrpc.Config
+	}
+	Db        database.Config
+	Sqlite    sqlite.Config
+	Migration migration.Config
+	Mailer    mailer.Config
+	Users     usecases.Config
+	Workers   workers.Config
+	Cache     cache.Config
+	Batching  batched.Config
+	Metrics   metrics.Config
+	Tracing   tracing.Config
+	Health    health.Config
+	Gateway   gateway.Config
+	Auth      auth.Config
+	RateLimit ratelimit.Config
+}
+
+const databaseURLEnv = "DATABASE_URL"
+
+// DefaultConfig holds the values used for keys missing from both the config
+// file and the environment.
+func DefaultConfig() *Config {
+	c := new(Config)
+	c.Log.Level = "info"
+	c.Grpc.Server = pkgGrpc.Config{
+		Address:   "localhost:50051",
+		Deadlines: pkgGrpc.DeadlineConfig{Default: 10 * time.Second},
+		Shutdown:  pkgGrpc.ShutdownConfig{DrainPeriod: 5 * time.Second, Timeout: 15 * time.Second},
+	}
+	c.Db = database.Config{
+		Driver:            database.DriverPostgres,
+		Host:              "localhost",
+		Port:              "5432",
+		User:              "postgres",
+		Database:          "my_database",
+		PoolSize:          "10",
+		SSLMode:           "disable",
+		MaxConnLifetime:   time.Hour,
+		MaxConnIdleTime:   30 * time.Minute,
+		HealthCheckPeriod: time.Minute,
+		QueryExecMode:     "cache_statement",
+		StartupTimeout:    time.Minute,
+		StatementTimeout:  30 * time.Second,
+		LockTimeout:       15 * time.Second,
+		// Replicas are checked every few seconds and usually lag by well
+		// under a second.
+		ReplicaCheckInterval: 5 * time.Second,
+		MaxReplicaLag:        10 * time.Second,
+		ReadYourWrites:       5 * time.Second,
+	}
+	c.Sqlite = sqlite.Config{Path: "twitter-users.db"}
+	c.Migration = migration.Config{NeedMigration: true, LockTimeout: 5 * time.Minute}
+	c.Mailer = mailer.Config{Driver: mailer.DriverLocal, From: "no-reply@twitter.local"}
+	c.Users = usecases.Config{
+		EmailChangeTTL:            24 * time.Hour,
+		PasswordHistorySize:       5,
+		PasswordHashCost:          10,
+		PasswordResetTTL:          time.Hour,
+		PasswordResetResponseTime: 500 * time.Millisecond,
+		UsernameCooldown:          720 * time.Hour,
+	}
+	c.Workers = workers.Config{TokenCleanupInterval: 10 * time.Minute}
+	c.Cache = cache.Config{Driver: cache.DriverMemory, Size: 10000, TTL: 5 * time.Minute}
+	c.Batching = batched.Config{Wait: 2 * time.Millisecond, MaxBatch: 100, Timeout: 10 * time.Second}
+	c.Metrics = metrics.Config{Enabled: true, Address: ":9090", Path: "/metrics"}
+	c.Tracing = tracing.Config{Exporter: tracing.ExporterNone, ServiceName: "twitter-users", SampleRatio: 1}
+	c.Health = health.Config{Interval: 10 * time.Second, Timeout: 2 * time.Second}
+	c.Gateway = gateway.Config{Enabled: true, Address: ":8080"}
+	c.RateLimit = ratelimit.Config{Enabled: true, Store: ratelimit.StoreMemory, SweepInterval: time.Minute}
+
+	return c
+}
+
+// NewConfig reads the configuration over the defaults and validates it.
+func NewConfig(configuration *configuration.Configuration) (*Config, error) {
+	c := DefaultConfig()
+	err := configuration.Unmarshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// DATABASE_URL is the name most platforms and tools use; db.url, from
+	// the file or DB_URL, takes precedence.
+	if c.Db.URL == "" {
+		c.Db.URL = os.Getenv(databaseURLEnv)
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s:\n%w", configuration.Path(), err)
+	}
+
+	return c, nil
+}
+
+type validator interface {
+	Validate() error
+}
+
+// Validate reports every problem at once, one per line, prefixed with the
+// section it belongs to.
+func (c *Config) Validate() error {
+	sections := []struct {
+		name   string
+		config validator
+	}{
+		{"grpc.server", c.Grpc.Server},
+		{"db", c.Db},
+		{"sqlite", c.Sqlite},
+		{"migration", c.Migration},
+		{"mailer", c.Mailer},
+		{"users", c.Users},
+		{"cache", c.Cache},
+		{"metrics", c.Metrics},
+		{"tracing", c.Tracing},
+		{"gateway", c.Gateway},
+		{"auth", c.Auth},
+		{"rateLimit", c.RateLimit},
+	}
+
+	var errs []error
+	if _, err := zapcore.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log: %w", err))
+	}
+
+	for _, section := range sections {
+		for _, err := range unwrapJoined(section.config.Validate()) {
+			errs = append(errs, fmt.Errorf("%s: %w", section.name, err))
+		}
+	}
+
+	if c.Db.Driver == database.DriverSqlite && c.RateLimit.Store == ratelimit.StorePostgres {
+		errs = append(errs, errors.New("rateLimit: the postgres store needs the postgres db driver"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func unwrapJoined(err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+
+	return []error{err}
+}
+
+// NewLogger builds the production logger around a level that can be changed
+// at runtime.
+func NewLogger(c *Config) (*zap.Logger, zap.AtomicLevel, error) {
+	level, err := zap.ParseAtomicLevel(c.Log.Level)
+	if err != nil {
+		return nil, level, err
+	}
+
+	loggerConfig := zap.NewProductionConfig()
+	loggerConfig.Level = level
+
+	log, err := loggerConfig.Build()
+	if err != nil {
+		return nil, level, err
+	}
+
+	return log, level, nil
+}
+
+// WatchConfig applies the keys that are safe to change at runtime, the log
+// level and the rate limits, when the config file changes. Everything else is
+// read once at startup and needs a restart.
+func WatchConfig(
+	configuration *configuration.Configuration,
+	level zap.AtomicLevel,
+	limiter *ratelimit.Limiter,
+	log *zap.Logger,
+) {
+	configuration.Watch(func() {
+		c, err := NewConfig(configuration)
+		if err != nil {
+			log.Error("ignoring config change", zap.Error(err))
+			return
+		}
+
+		err = limiter.SetLimits(c.RateLimit.Limits)
+		if err != nil {
+			log.Error("ignoring config change", zap.Error(err))
+			return
+		}
+
+		lvl, _ := zapcore.ParseLevel(c.Log.Level)
+		level.SetLevel(lvl)
+
+		log.Info("config reloaded",
+			zap.String("log_level", lvl.String()),
+			zap.Int("rate_limits", len(c.RateLimit.Limits)))
+	})
+}
@@ -0,0 +1,44 @@
+package app_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vorotilkin/twitter-users/pkg/configuration"
+	"github.com/vorotilkin/twitter-users/server/app"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShippedConfig(t *testing.T) {
+	c, err := app.NewConfig(configuration.New("../../config.yaml"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "localhost:50051", c.Grpc.Server.Address)
+}
+
+func TestDatabaseURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	t.Setenv("DATABASE_URL", "postgres://platform@db/users")
+
+	c, err := app.NewConfig(configuration.New(path))
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://platform@db/users", c.Db.URL)
+
+	t.Setenv("DB_URL", "postgres://explicit@db/users")
+
+	c, err = app.NewConfig(configuration.New(path))
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://explicit@db/users", c.Db.URL, "db.url wins over DATABASE_URL")
+}
+
+func TestDeprecatedMigrationPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("migration:\n  path: \"./schema/migrations\"\n  needMigration: true\n"), 0o600))
+
+	c, err := app.NewConfig(configuration.New(path))
+	require.NoError(t, err, "older config files still load")
+	assert.Equal(t, "./schema/migrations", c.Migration.Path)
+}
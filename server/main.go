@@ -2,79 +2,50 @@ package main
 
 import (
 	"context"
-	"github.com/vorotilkin/twitter-users/infrastructure/repositories/user"
-	"github.com/vorotilkin/twitter-users/interfaces"
+	"flag"
+	"fmt"
 	"github.com/vorotilkin/twitter-users/pkg/configuration"
-	"github.com/vorotilkin/twitter-users/pkg/database"
-	pkgGrpc "github.com/vorotilkin/twitter-users/pkg/grpc"
-	"github.com/vorotilkin/twitter-users/pkg/migration"
-	"github.com/vorotilkin/twitter-users/proto"
-	"github.com/vorotilkin/twitter-users/usecases"
+	"github.com/vorotilkin/twitter-users/server/app"
 	"go.uber.org/fx"
-	"go.uber.org/fx/fxevent"
-	"go.uber.org/zap"
-	"google.golang.org/grpc"
+	"os"
 )
 
-type config struct {
-	Grpc struct {
-		Server pkgGrpc.Config
-	}
-	Db        database.Config
-	Migration migration.Config
-}
+func main() {
+	configPath := flag.String("config", os.Getenv(configuration.PathEnv), "path to the YAML config file")
+	flag.Parse()
 
-func newConfig(configuration *configuration.Configuration) (*config, error) {
-	c := new(config)
-	err := configuration.Unmarshal(c)
+	// The config is loaded before the app is built so that a broken config
+	// is reported as is rather than inside a dependency graph error.
+	conf := configuration.New(*configPath)
+	c, err := app.NewConfig(conf)
 	if err != nil {
-		return nil, err
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	return c, nil
-}
+	if flag.Arg(0) == "migrate" {
+		err = runMigrate(c, flag.Args()[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-func main() {
-	opts := []fx.Option{
-		fx.Provide(zap.NewProduction),
-		fx.WithLogger(func(log *zap.Logger) fxevent.Logger {
-			return &fxevent.ZapLogger{Logger: log}
-		}),
-		fx.Provide(configuration.New),
-		fx.Provide(newConfig),
-		fx.Provide(func(c *config) pkgGrpc.Config {
-			return c.Grpc.Server
-		}),
-		fx.Provide(func(c *config) database.Config {
-			return c.Db
-		}),
-		fx.Provide(database.New),
-		fx.Provide(func(c *config) migration.Config { return c.Migration }),
-		fx.Provide(fx.Annotate(func(c *config) string { return c.Db.PostgresDSN() }, fx.ResultTags(`name:"dsn"`))),
-		fx.Provide(fx.Annotate(pkgGrpc.NewServer,
-			fx.As(new(grpc.ServiceRegistrar)),
-			fx.As(new(interfaces.Hooker)))),
-		fx.Provide(fx.Annotate(user.NewRepository, fx.As(new(usecases.UsersRepository)))),
-		fx.Provide(fx.Annotate(usecases.NewUsersServer, fx.As(new(proto.UsersServer)))),
-		fx.Invoke(func(lc fx.Lifecycle, server interfaces.Hooker) {
-			lc.Append(fx.Hook{
-				OnStart: server.OnStart,
-				OnStop:  server.OnStop,
-			})
-		}),
-		fx.Invoke(fx.Annotate(migration.Do, fx.ParamTags("", "", `name:"dsn"`))),
-		fx.Invoke(proto.RegisterUsersServer),
+		return
 	}
 
-	app := fx.New(opts...)
-	err := app.Start(context.Background())
+	application := fx.New(
+		app.Options(c),
+		fx.Supply(conf),
+		fx.Invoke(app.WatchConfig),
+	)
+	err = application.Start(context.Background())
 	if err != nil {
 		panic(err)
 	}
 
-	<-app.Done()
+	<-application.Done()
 
-	err = app.Stop(context.Background())
+	err = application.Stop(context.Background())
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vorotilkin/twitter-users/pkg/database"
+	"github.com/vorotilkin/twitter-users/pkg/migration"
+	"github.com/vorotilkin/twitter-users/schema/migrations"
+	"github.com/vorotilkin/twitter-users/server/app"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: server [--config file] migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations, 1 by default
+  status      list migrations and when they were applied
+  dry-run     print the SQL that up would run`
+
+// runMigrate serves the migrate subcommand, which manages the schema without
+// starting the service.
+func runMigrate(c *app.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if c.Db.Driver == database.DriverSqlite {
+		return errors.New("migrate manages Postgres; SQLite is migrated when the service starts")
+	}
+
+	log, _, err := app.NewLogger(c)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = log.Sync() }()
+
+	migrator, err := migration.New(c.Migration, log, c.Db.PostgresDSN(), migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command := args[0]; {
+	case command == "up" && len(args) == 1:
+		applied, err := migrator.Up(ctx)
+		printMigrations("applied", applied)
+
+		return err
+	case command == "down" && len(args) <= 2:
+		n := 1
+		if len(args) == 2 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down expects a positive number of migrations, got %q", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, n)
+		printMigrations("reverted", reverted)
+
+		return err
+	case command == "status" && len(args) == 1:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED")
+
+		for _, status := range statuses {
+			applied := "pending"
+			if !status.AppliedAt.IsZero() {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\n", status.Version, status.Description, applied)
+		}
+
+		return w.Flush()
+	case command == "dry-run" && len(args) == 1:
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range pending {
+			fmt.Printf("-- %s_%s\n%s\n", m.Version, m.Description, m.Up)
+		}
+
+		if len(pending) == 0 {
+			fmt.Println("-- no pending migrations")
+		}
+
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func printMigrations(verb string, list []migration.Migration) {
+	for _, m := range list {
+		fmt.Printf("%s %s_%s\n", verb, m.Version, m.Description)
+	}
+
+	if len(list) == 0 {
+		fmt.Printf("nothing %s\n", verb)
+	}
+}
@@ -0,0 +1,138 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"github.com/vorotilkin/twitter-users/pkg/token"
+	"github.com/vorotilkin/twitter-users/proto"
+	"github.com/vorotilkin/twitter-users/usecases/hydrators"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net/mail"
+	"time"
+)
+
+const defaultEmailChangeTTL = 24 * time.Hour
+
+type EmailChangeRepository interface {
+	SaveEmailChange(ctx context.Context, userID int32, newEmail, tokenHash string, expiresAt time.Time) error
+	ConfirmEmailChange(ctx context.Context, tokenHash string, now time.Time) (models.EmailChange, error)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+func (s *UsersServer) RequestEmailChange(ctx context.Context, request *proto.RequestEmailChangeRequest) (*proto.RequestEmailChangeResponse, error) {
+	userID := request.GetUserId()
+	if userID <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid id")
+	}
+
+	address, err := mail.ParseAddress(request.GetNewEmail())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid email")
+	}
+
+	newEmail := address.Address
+
+	users, err := s.usersRepository.UsersByIDs(ctx, []int32{userID})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	user, exist := lo.Find(users, func(user models.User) bool {
+		return user.ID == userID
+	})
+	if !exist {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	if user.Email == newEmail {
+		return nil, status.Error(codes.InvalidArgument, "email not changed")
+	}
+
+	owner, err := s.usersRepository.UserByEmail(ctx, newEmail)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if owner.ID != 0 {
+		return nil, status.Error(codes.AlreadyExists, "email already taken")
+	}
+
+	plain, hash, err := token.New()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	expiresAt := time.Now().UTC().Add(s.emailChangeTTL())
+
+	err = s.emailChangeRepository.SaveEmailChange(ctx, userID, newEmail, hash, expiresAt)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	err = s.mailer.Send(ctx, newEmail, "Confirm your new email",
+		fmt.Sprintf("Use this code to confirm your new email address: %s\nThe code expires at %s.",
+			plain, expiresAt.Format(time.RFC1123)))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &proto.RequestEmailChangeResponse{ExpiresAt: timestamppb.New(expiresAt)}, nil
+}
+
+func (s *UsersServer) ConfirmEmailChange(ctx context.Context, request *proto.ConfirmEmailChangeRequest) (*proto.ConfirmEmailChangeResponse, error) {
+	plain := request.GetToken()
+	if len(plain) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	change, err := s.emailChangeRepository.ConfirmEmailChange(ctx, token.Hash(plain), time.Now().UTC())
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, models.ErrEmailTaken) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	err = s.mailer.Send(ctx, change.OldEmail, "Your email was changed",
+		fmt.Sprintf("The email address of your account was changed to %s.", change.NewEmail))
+	if err != nil {
+		requestid.Logger(ctx, s.logger).Warn("failed to notify old email", zap.Int32("user_id", change.UserID), zap.Error(err))
+	}
+
+	users, err := s.usersRepository.UsersByIDs(ctx, []int32{change.UserID})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	user, exist := lo.Find(users, func(user models.User) bool {
+		return user.ID == change.UserID
+	})
+	if !exist {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	return &proto.ConfirmEmailChangeResponse{
+		User: hydrators.ProtoUser(ctx, user),
+	}, nil
+}
+
+func (s *UsersServer) emailChangeTTL() time.Duration {
+	if s.config.EmailChangeTTL <= 0 {
+		return defaultEmailChangeTTL
+	}
+
+	return s.config.EmailChangeTTL
+}
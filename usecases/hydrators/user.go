@@ -1,28 +1,52 @@
 package hydrators
 
 import (
+	"context"
 	"github.com/samber/lo"
 	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/auth"
 	"github.com/vorotilkin/twitter-users/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
 )
 
-func ProtoUsers(users []models.User) []*proto.User {
+func ProtoUsers(ctx context.Context, users []models.User) []*proto.User {
 	return lo.Map(users, func(user models.User, _ int) *proto.User {
-		return ProtoUser(user)
+		return ProtoUser(ctx, user)
 	})
 }
 
-func ProtoUser(user models.User) *proto.User {
+// ProtoUser is user as the caller in ctx may see it. The password hash is
+// never shown, PasswordHashByEmail returns it to services. The email is
+// hidden from users other than its owner; calls without an identity are
+// either unauthenticated public ones, which only return the caller's own
+// record, or made with authentication disabled.
+func ProtoUser(ctx context.Context, user models.User) *proto.User {
+	email := user.Email
+
+	identity, ok := auth.FromContext(ctx)
+	if ok && !identity.IsService() && identity.UserID != user.ID {
+		email = ""
+	}
+
 	return &proto.User{
-		Id:               user.ID,
-		Name:             user.Name,
-		PasswordHash:     user.PasswordHash,
-		Username:         user.Username,
-		Email:            user.Email,
-		Bio:              user.Bio,
-		ProfileImage:     user.ProfileImage,
-		CoverImage:       user.CoverImage,
-		FollowingUserIds: user.FollowingIDs,
-		FollowerUserIds:  user.FollowerIDs,
+		Id:                user.ID,
+		Name:              user.Name,
+		Username:          user.Username,
+		Email:             email,
+		Bio:               user.Bio,
+		ProfileImage:      user.ProfileImage,
+		CoverImage:        user.CoverImage,
+		FollowingUserIds:  user.FollowingIDs,
+		FollowerUserIds:   user.FollowerIDs,
+		PasswordChangedAt: timestamp(user.PasswordChangedAt),
 	}
 }
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
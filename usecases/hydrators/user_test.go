@@ -0,0 +1,33 @@
+package hydrators_test
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/auth"
+	"github.com/vorotilkin/twitter-users/usecases/hydrators"
+	"testing"
+)
+
+func TestProtoUser(t *testing.T) {
+	user := models.User{ID: 1, Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+
+	for _, tt := range []struct {
+		name      string
+		ctx       context.Context
+		wantEmail string
+	}{
+		{name: "owner", ctx: auth.WithIdentity(context.Background(), auth.Identity{UserID: 1}), wantEmail: user.Email},
+		{name: "other user", ctx: auth.WithIdentity(context.Background(), auth.Identity{UserID: 2})},
+		{name: "service", ctx: auth.WithIdentity(context.Background(), auth.Identity{Service: "auth"}), wantEmail: user.Email},
+		{name: "unauthenticated", ctx: context.Background(), wantEmail: user.Email},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hydrators.ProtoUser(tt.ctx, user)
+
+			assert.Equal(t, "alice", got.GetUsername())
+			assert.Equal(t, tt.wantEmail, got.GetEmail())
+			assert.Empty(t, got.PasswordHash)
+		})
+	}
+}
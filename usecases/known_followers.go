@@ -0,0 +1,69 @@
+package usecases
+
+import (
+	"context"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/proto"
+	"github.com/vorotilkin/twitter-users/usecases/hydrators"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultKnownFollowersLimit = 3
+	maxKnownFollowersLimit     = 100
+)
+
+type FollowGraphRepository interface {
+	// KnownFollowers returns up to limit ids of the users viewerID follows who
+	// also follow targetID, those who followed targetID last first, and how
+	// many such users there are in all.
+	KnownFollowers(ctx context.Context, viewerID, targetID int32, limit int) ([]int32, int, error)
+}
+
+// KnownFollowers answers "followed by X, Y and N others you follow". The
+// intersection is computed by the repository, so only the users shown are
+// loaded.
+func (s *UsersServer) KnownFollowers(ctx context.Context, request *proto.KnownFollowersRequest) (*proto.KnownFollowersResponse, error) {
+	viewerID, targetID := request.GetViewerId(), request.GetTargetId()
+	if viewerID <= 0 || targetID <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid id")
+	}
+
+	limit := int(request.GetLimit())
+	if limit < 0 || limit > maxKnownFollowersLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 0 and %d", maxKnownFollowersLimit)
+	}
+
+	if limit == 0 {
+		limit = defaultKnownFollowersLimit
+	}
+
+	ids, total, err := s.followGraphRepository.KnownFollowers(ctx, viewerID, targetID, limit)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if len(ids) == 0 {
+		return &proto.KnownFollowersResponse{Total: int32(total)}, nil
+	}
+
+	users, err := s.usersRepository.UsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// UsersByIDs does not keep the order of ids, and drops users deleted
+	// since the intersection was read.
+	byID := lo.KeyBy(users, func(user models.User) int32 { return user.ID })
+	ordered := lo.FilterMap(ids, func(id int32, _ int) (models.User, bool) {
+		user, ok := byID[id]
+		return user, ok
+	})
+
+	return &proto.KnownFollowersResponse{
+		Users: hydrators.ProtoUsers(ctx, ordered),
+		Total: int32(total),
+	}, nil
+}
@@ -0,0 +1,105 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/proto"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+const (
+	defaultPasswordHistorySize = 5
+	minPasswordLength          = 8
+)
+
+type PasswordRepository interface {
+	PasswordHashes(ctx context.Context, userID int32, limit int) ([]string, error)
+	ChangePassword(ctx context.Context, userID int32, currentHash, newHash string, historySize int, changedAt time.Time) error
+}
+
+func (s *UsersServer) ChangePassword(ctx context.Context, request *proto.ChangePasswordRequest) (*proto.ChangePasswordResponse, error) {
+	userID := request.GetUserId()
+	if userID <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid id")
+	}
+
+	hashes, err := s.passwordRepository.PasswordHashes(ctx, userID, s.passwordHistorySize())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if len(hashes) == 0 {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	currentHash := hashes[0]
+
+	err = bcrypt.CompareHashAndPassword([]byte(currentHash), []byte(request.GetCurrentPassword()))
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, "invalid current password")
+	}
+
+	newHash, err := s.newPasswordHash(request.GetNewPassword(), hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	changedAt := time.Now().UTC()
+
+	err = s.passwordRepository.ChangePassword(ctx, userID, currentHash, newHash, s.passwordHistorySize(), changedAt)
+	if errors.Is(err, models.ErrPasswordChanged) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &proto.ChangePasswordResponse{PasswordChangedAt: timestamppb.New(changedAt)}, nil
+}
+
+// newPasswordHash validates password against the policy and the recently
+// used hashes and returns its bcrypt hash. Errors are gRPC statuses.
+func (s *UsersServer) newPasswordHash(password string, recentHashes []string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", status.Errorf(codes.InvalidArgument, "password must be at least %d characters", minPasswordLength)
+	}
+
+	reused := lo.ContainsBy(recentHashes, func(hash string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	})
+	if reused {
+		return "", status.Error(codes.FailedPrecondition, "password was used recently")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.passwordHashCost())
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	return string(hash), nil
+}
+
+func (s *UsersServer) passwordHistorySize() int {
+	if s.config.PasswordHistorySize <= 0 {
+		return defaultPasswordHistorySize
+	}
+
+	return s.config.PasswordHistorySize
+}
+
+func (s *UsersServer) passwordHashCost() int {
+	if s.config.PasswordHashCost <= 0 {
+		return bcrypt.DefaultCost
+	}
+
+	return s.config.PasswordHashCost
+}
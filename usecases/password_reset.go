@@ -0,0 +1,149 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/pkg/requestid"
+	"github.com/vorotilkin/twitter-users/pkg/token"
+	"github.com/vorotilkin/twitter-users/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+const (
+	defaultPasswordResetTTL          = time.Hour
+	defaultPasswordResetResponseTime = 500 * time.Millisecond
+	// passwordResetSendTimeout bounds the lookup, the token insert and the
+	// mail, which outlive the request.
+	passwordResetSendTimeout = time.Minute
+)
+
+type PasswordResetRepository interface {
+	SavePasswordResetToken(ctx context.Context, userID int32, tokenHash string, expiresAt time.Time) error
+	PasswordResetUserID(ctx context.Context, tokenHash string, now time.Time) (int32, error)
+	ResetPassword(ctx context.Context, tokenHash string, userID int32, currentHash, newHash string, historySize int, now time.Time) error
+}
+
+// RequestPasswordReset always answers with an empty response after the same
+// fixed delay so callers can not tell registered emails from unknown ones.
+// The reset is sent in the background, so neither a slow lookup nor a slow
+// mail server shows in the response time, and failures are only logged.
+func (s *UsersServer) RequestPasswordReset(ctx context.Context, request *proto.RequestPasswordResetRequest) (*proto.RequestPasswordResetResponse, error) {
+	deadline := time.NewTimer(s.passwordResetResponseTime())
+	defer deadline.Stop()
+
+	// The request id and trace stay, the cancellation of the call does not.
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetSendTimeout)
+	email := request.GetEmail()
+
+	go func() {
+		defer cancel()
+
+		err := s.sendPasswordReset(sendCtx, email)
+		if err != nil {
+			requestid.Logger(sendCtx, s.logger).Error("failed to send password reset", zap.Error(err))
+		}
+	}()
+
+	select {
+	case <-deadline.C:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	return &proto.RequestPasswordResetResponse{}, nil
+}
+
+func (s *UsersServer) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.usersRepository.UserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if user.ID == 0 {
+		return nil
+	}
+
+	plain, hash, err := token.New()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().UTC().Add(s.passwordResetTTL())
+
+	err = s.passwordResetRepository.SavePasswordResetToken(ctx, user.ID, hash, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, user.Email, "Reset your password",
+		fmt.Sprintf("Use this code to reset your password: %s\nThe code expires at %s. "+
+			"If you did not request a reset, ignore this message.",
+			plain, expiresAt.Format(time.RFC1123)))
+}
+
+func (s *UsersServer) ResetPassword(ctx context.Context, request *proto.ResetPasswordRequest) (*proto.ResetPasswordResponse, error) {
+	plain := request.GetToken()
+	if len(plain) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty token")
+	}
+
+	tokenHash := token.Hash(plain)
+	now := time.Now().UTC()
+
+	userID, err := s.passwordResetRepository.PasswordResetUserID(ctx, tokenHash, now)
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	hashes, err := s.passwordRepository.PasswordHashes(ctx, userID, s.passwordHistorySize())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if len(hashes) == 0 {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	newHash, err := s.newPasswordHash(request.GetNewPassword(), hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.passwordResetRepository.ResetPassword(ctx, tokenHash, userID, hashes[0], newHash, s.passwordHistorySize(), now)
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, models.ErrPasswordChanged) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &proto.ResetPasswordResponse{PasswordChangedAt: timestamppb.New(now)}, nil
+}
+
+func (s *UsersServer) passwordResetTTL() time.Duration {
+	if s.config.PasswordResetTTL <= 0 {
+		return defaultPasswordResetTTL
+	}
+
+	return s.config.PasswordResetTTL
+}
+
+func (s *UsersServer) passwordResetResponseTime() time.Duration {
+	if s.config.PasswordResetResponseTime <= 0 {
+		return defaultPasswordResetResponseTime
+	}
+
+	return s.config.PasswordResetResponseTime
+}
@@ -0,0 +1,35 @@
+package usecases
+
+import (
+	"github.com/vorotilkin/twitter-users/pkg/auth"
+	"github.com/vorotilkin/twitter-users/proto"
+)
+
+// Policy lists which users may call each Users RPC. RPCs missing here, like
+// PasswordHashByEmail and UserByEmail, are reserved for allow-listed services.
+func Policy() auth.Policy {
+	return auth.Policy{
+		proto.Users_Create_FullMethodName:               {Public: true},
+		proto.Users_ConfirmEmailChange_FullMethodName:   {Public: true},
+		proto.Users_RequestPasswordReset_FullMethodName: {Public: true},
+		proto.Users_ResetPassword_FullMethodName:        {Public: true},
+		proto.Users_UsersByIDs_FullMethodName:           {AnyUser: true},
+		proto.Users_NewUsers_FullMethodName:             {AnyUser: true},
+		proto.Users_ResolveUsername_FullMethodName:      {AnyUser: true},
+		proto.Users_UpdateByID_FullMethodName: {Owner: func(req any) int32 {
+			return req.(*proto.UpdateByIDRequest).GetId()
+		}},
+		proto.Users_Follow_FullMethodName: {Owner: func(req any) int32 {
+			return req.(*proto.FollowRequest).GetUserId()
+		}},
+		proto.Users_RequestEmailChange_FullMethodName: {Owner: func(req any) int32 {
+			return req.(*proto.RequestEmailChangeRequest).GetUserId()
+		}},
+		proto.Users_ChangePassword_FullMethodName: {Owner: func(req any) int32 {
+			return req.(*proto.ChangePasswordRequest).GetUserId()
+		}},
+		proto.Users_KnownFollowers_FullMethodName: {Owner: func(req any) int32 {
+			return req.(*proto.KnownFollowersRequest).GetViewerId()
+		}},
+	}
+}
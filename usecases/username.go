@@ -0,0 +1,91 @@
+package usecases
+
+import (
+	"context"
+	"github.com/samber/lo"
+	"github.com/vorotilkin/twitter-users/domain/models"
+	"github.com/vorotilkin/twitter-users/proto"
+	"github.com/vorotilkin/twitter-users/usecases/hydrators"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const defaultUsernameCooldown = 30 * 24 * time.Hour
+
+type UsernameRepository interface {
+	UserIDByUsername(ctx context.Context, username string) (int32, error)
+	PreviousUsernameOwner(ctx context.Context, username string, since time.Time) (int32, error)
+}
+
+// ResolveUsername finds the user holding username. When nobody holds it but
+// it was given up by someone, that user is returned with renamed set.
+func (s *UsersServer) ResolveUsername(ctx context.Context, request *proto.ResolveUsernameRequest) (*proto.ResolveUsernameResponse, error) {
+	username := request.GetUsername()
+	if len(username) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "empty username")
+	}
+
+	userID, err := s.usernameRepository.UserIDByUsername(ctx, username)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	renamed := false
+
+	if userID == 0 {
+		userID, err = s.usernameRepository.PreviousUsernameOwner(ctx, username, time.Time{})
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		renamed = true
+	}
+
+	if userID == 0 {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	users, err := s.usersRepository.UsersByIDs(ctx, []int32{userID})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	user, exist := lo.Find(users, func(user models.User) bool {
+		return user.ID == userID
+	})
+	if !exist {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+
+	return &proto.ResolveUsernameResponse{
+		User:    hydrators.ProtoUser(ctx, user),
+		Renamed: renamed,
+	}, nil
+}
+
+// checkUsernameAvailable rejects usernames given up by another account
+// within the cooldown. userID is the account claiming the username, zero for
+// a new one.
+func (s *UsersServer) checkUsernameAvailable(ctx context.Context, username string, userID int32) error {
+	since := time.Now().UTC().Add(-s.usernameCooldown())
+
+	owner, err := s.usernameRepository.PreviousUsernameOwner(ctx, username, since)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if owner != 0 && owner != userID {
+		return status.Error(codes.FailedPrecondition, "username is reserved")
+	}
+
+	return nil
+}
+
+func (s *UsersServer) usernameCooldown() time.Duration {
+	if s.config.UsernameCooldown <= 0 {
+		return defaultUsernameCooldown
+	}
+
+	return s.config.UsernameCooldown
+}
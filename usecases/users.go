@@ -3,13 +3,18 @@ package usecases
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/samber/lo"
 	"github.com/samber/mo"
 	"github.com/vorotilkin/twitter-users/domain/models"
 	"github.com/vorotilkin/twitter-users/proto"
 	"github.com/vorotilkin/twitter-users/usecases/hydrators"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"time"
 )
 
 type UsersRepository interface {
@@ -23,19 +28,61 @@ type UsersRepository interface {
 	NewUsers(ctx context.Context, limit int32) ([]models.User, error)
 }
 
+type Config struct {
+	EmailChangeTTL            time.Duration
+	PasswordHistorySize       int
+	PasswordHashCost          int
+	PasswordResetTTL          time.Duration
+	PasswordResetResponseTime time.Duration
+	UsernameCooldown          time.Duration
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if c.PasswordHashCost != 0 && (c.PasswordHashCost < bcrypt.MinCost || c.PasswordHashCost > bcrypt.MaxCost) {
+		errs = append(errs, fmt.Errorf("passwordHashCost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+
+	if c.PasswordHistorySize < 0 {
+		errs = append(errs, errors.New("passwordHistorySize must not be negative"))
+	}
+
+	if c.EmailChangeTTL < 0 || c.PasswordResetTTL < 0 || c.PasswordResetResponseTime < 0 || c.UsernameCooldown < 0 {
+		errs = append(errs, errors.New("durations must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
 type UsersServer struct {
 	proto.UnimplementedUsersServer
-	usersRepository UsersRepository
+	config                  Config
+	logger                  *zap.Logger
+	usersRepository         UsersRepository
+	emailChangeRepository   EmailChangeRepository
+	passwordRepository      PasswordRepository
+	passwordResetRepository PasswordResetRepository
+	usernameRepository      UsernameRepository
+	followGraphRepository   FollowGraphRepository
+	mailer                  Mailer
 }
 
 func (s *UsersServer) Create(ctx context.Context, request *proto.CreateRequest) (*proto.CreateResponse, error) {
+	err := s.checkUsernameAvailable(ctx, request.GetUsername(), 0)
+	if err != nil {
+		return nil, err
+	}
+
 	user, err := s.usersRepository.Create(ctx, request.GetName(), request.GetPasswordHash(), request.GetUsername(), request.GetEmail())
+	if errors.Is(err, models.ErrEmailTaken) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &proto.CreateResponse{
-		User: hydrators.ProtoUser(user),
+		User: hydrators.ProtoUser(ctx, user),
 	}, nil
 }
 
@@ -63,7 +110,7 @@ func (s *UsersServer) UserByEmail(ctx context.Context, request *proto.UserByEmai
 	}
 
 	return &proto.UserByEmailResponse{
-		User: hydrators.ProtoUser(user),
+		User: hydrators.ProtoUser(ctx, user),
 	}, nil
 }
 
@@ -79,7 +126,7 @@ func (s *UsersServer) UsersByIDs(ctx context.Context, request *proto.UsersByIDsR
 	}
 
 	return &proto.UsersByIDsResponse{
-		Users: hydrators.ProtoUsers(users),
+		Users: hydrators.ProtoUsers(ctx, users),
 	}, nil
 }
 
@@ -93,6 +140,18 @@ func (s *UsersServer) UpdateByID(ctx context.Context, request *proto.UpdateByIDR
 		return nil, status.Error(codes.InvalidArgument, "invalid id")
 	}
 
+	mask, err := updateMask(request.GetUpdateMask())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if request.Username != nil {
+		err = s.checkUsernameAvailable(ctx, request.GetUsername(), userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	userToUpdate := models.UserOption{
 		ID:           userID,
 		Name:         mo.PointerToOption(request.Name),
@@ -100,12 +159,16 @@ func (s *UsersServer) UpdateByID(ctx context.Context, request *proto.UpdateByIDR
 		Bio:          mo.PointerToOption(request.Bio),
 		ProfileImage: mo.PointerToOption(request.ProfileImage),
 		CoverImage:   mo.PointerToOption(request.CoverImage),
+		Mask:         mask,
 	}
 
 	ok, err := s.usersRepository.UpdateByID(ctx, userToUpdate)
 	if errors.Is(err, models.ErrNothingToUpdate) {
 		return nil, status.Error(codes.InvalidArgument, "nothing to update")
 	}
+	if errors.Is(err, models.ErrFieldNotNullable) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -128,10 +191,26 @@ func (s *UsersServer) UpdateByID(ctx context.Context, request *proto.UpdateByIDR
 	}
 
 	return &proto.UpdateByIDResponse{
-		User: hydrators.ProtoUser(user),
+		User: hydrators.ProtoUser(ctx, user),
 	}, nil
 }
 
+func updateMask(fieldMask *fieldmaskpb.FieldMask) ([]models.UserField, error) {
+	paths := lo.Uniq(fieldMask.GetPaths())
+	mask := make([]models.UserField, 0, len(paths))
+
+	for _, path := range paths {
+		field, ok := models.ParseUserField(path)
+		if !ok {
+			return nil, fmt.Errorf("invalid update_mask path %q", path)
+		}
+
+		mask = append(mask, field)
+	}
+
+	return mask, nil
+}
+
 func (s *UsersServer) Follow(ctx context.Context, request *proto.FollowRequest) (*proto.FollowResponse, error) {
 	userID := request.GetUserId()
 	if userID <= 0 {
@@ -171,11 +250,29 @@ func (s *UsersServer) NewUsers(ctx context.Context, request *proto.NewUsersReque
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	return &proto.NewUsersResponse{Users: hydrators.ProtoUsers(users)}, nil
+	return &proto.NewUsersResponse{Users: hydrators.ProtoUsers(ctx, users)}, nil
 }
 
-func NewUsersServer(usersRepo UsersRepository) *UsersServer {
+func NewUsersServer(
+	config Config,
+	logger *zap.Logger,
+	usersRepo UsersRepository,
+	emailChangeRepo EmailChangeRepository,
+	passwordRepo PasswordRepository,
+	passwordResetRepo PasswordResetRepository,
+	usernameRepo UsernameRepository,
+	followGraphRepo FollowGraphRepository,
+	mailer Mailer,
+) *UsersServer {
 	return &UsersServer{
-		usersRepository: usersRepo,
+		config:                  config,
+		logger:                  logger,
+		usersRepository:         usersRepo,
+		emailChangeRepository:   emailChangeRepo,
+		passwordRepository:      passwordRepo,
+		passwordResetRepository: passwordResetRepo,
+		usernameRepository:      usernameRepo,
+		followGraphRepository:   followGraphRepo,
+		mailer:                  mailer,
 	}
 }
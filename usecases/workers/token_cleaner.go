@@ -0,0 +1,87 @@
+package workers
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+const defaultTokenCleanupInterval = 10 * time.Minute
+
+type Config struct {
+	TokenCleanupInterval time.Duration
+}
+
+type ExpiredTokensRepository interface {
+	DeleteExpiredTokens(ctx context.Context, now time.Time) (int64, error)
+}
+
+// TokenCleaner periodically removes expired and used one-time tokens.
+type TokenCleaner struct {
+	config     Config
+	logger     *zap.Logger
+	repository ExpiredTokensRepository
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func (c *TokenCleaner) OnStart(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	go c.run(ctx)
+
+	return nil
+}
+
+func (c *TokenCleaner) OnStop(ctx context.Context) error {
+	c.cancel()
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *TokenCleaner) run(ctx context.Context) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := c.repository.DeleteExpiredTokens(ctx, time.Now().UTC())
+			if err != nil {
+				c.logger.Error("failed to delete expired tokens", zap.Error(err))
+				continue
+			}
+
+			if deleted > 0 {
+				c.logger.Info("expired tokens deleted", zap.Int64("count", deleted))
+			}
+		}
+	}
+}
+
+func (c *TokenCleaner) interval() time.Duration {
+	if c.config.TokenCleanupInterval <= 0 {
+		return defaultTokenCleanupInterval
+	}
+
+	return c.config.TokenCleanupInterval
+}
+
+func NewTokenCleaner(c Config, log *zap.Logger, repository ExpiredTokensRepository) *TokenCleaner {
+	return &TokenCleaner{
+		config:     c,
+		logger:     log,
+		repository: repository,
+		done:       make(chan struct{}),
+	}
+}